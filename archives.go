@@ -0,0 +1,323 @@
+package updaterini
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrorArchiveEntryPathInvalid = errors.New("error. archive entry path is invalid")
+	ErrorArchiveLimitExceeded    = errors.New("error. archive limit exceeded")
+)
+
+const (
+	defaultArchiveMaxTotalSize        = 4 << 30
+	defaultArchiveMaxEntries          = 100000
+	defaultArchiveMaxCompressionRatio = 200
+	// compression ratio of small archives is not checked, text files could be compressed well
+	archiveRatioCheckMinSize = 1 << 20
+)
+
+/*
+	ArchiveLimits of archive assets extraction, protects from archive bombs.
+	Limits are checked for every archive, negative limit disables check
+*/
+type ArchiveLimits struct {
+	MaxTotalSize        int64   // max total size of archive extracted files, 4 GiB on 0
+	MaxEntries          int     // max count of archive entries (including directories), 100000 on 0
+	MaxCompressionRatio float64 // max ratio of archive extracted files total size to archive size, 200 on 0
+}
+
+func (al ArchiveLimits) getMaxTotalSize() int64 {
+	if al.MaxTotalSize == 0 {
+		return defaultArchiveMaxTotalSize
+	}
+	return al.MaxTotalSize
+}
+
+func (al ArchiveLimits) getMaxEntries() int {
+	if al.MaxEntries == 0 {
+		return defaultArchiveMaxEntries
+	}
+	return al.MaxEntries
+}
+
+func (al ArchiveLimits) getMaxCompressionRatio() float64 {
+	if al.MaxCompressionRatio == 0 {
+		return defaultArchiveMaxCompressionRatio
+	}
+	return al.MaxCompressionRatio
+}
+
+type ArchiveLimit int
+
+const (
+	ArchiveLimitTotalSize        ArchiveLimit = iota // ArchiveLimits.MaxTotalSize
+	ArchiveLimitEntries                              // ArchiveLimits.MaxEntries
+	ArchiveLimitCompressionRatio                     // ArchiveLimits.MaxCompressionRatio
+)
+
+func (al ArchiveLimit) String() string {
+	switch al {
+	case ArchiveLimitTotalSize:
+		return "max total size"
+	case ArchiveLimitEntries:
+		return "max entries count"
+	case ArchiveLimitCompressionRatio:
+		return "max compression ratio"
+	}
+	return "unknown limit"
+}
+
+// ArchiveLimitError describes exceeded archive limit, it matches ErrorArchiveLimitExceeded
+type ArchiveLimitError struct {
+	Archive string // archive asset filename
+	Limit   ArchiveLimit
+}
+
+func (e *ArchiveLimitError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", ErrorArchiveLimitExceeded, e.Limit, e.Archive)
+}
+
+func (e *ArchiveLimitError) Is(target error) bool {
+	return target == ErrorArchiveLimitExceeded
+}
+
+// archive extraction limits counter
+type archiveLimiter struct {
+	limits      ArchiveLimits
+	archive     string
+	archiveSize int64
+	entries     int
+	extracted   int64
+}
+
+func newArchiveLimiter(limits ArchiveLimits, archiveFilename, archiveFPath string) (*archiveLimiter, error) {
+	info, err := os.Stat(archiveFPath)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveLimiter{
+		limits:      limits,
+		archive:     archiveFilename,
+		archiveSize: info.Size(),
+	}, nil
+}
+
+/*
+	count archive entry
+
+	size - entry size from archive header, it's checked before extraction. Real extracted size is checked by reader
+*/
+func (al *archiveLimiter) addEntry(size int64) error {
+	al.entries++
+	if maxEntries := al.limits.getMaxEntries(); maxEntries >= 0 && al.entries > maxEntries {
+		return &ArchiveLimitError{Archive: al.archive, Limit: ArchiveLimitEntries}
+	}
+	if size > 0 {
+		return al.checkExtractedSize(al.extracted + size)
+	}
+	return nil
+}
+
+func (al *archiveLimiter) checkExtractedSize(extracted int64) error {
+	if maxTotalSize := al.limits.getMaxTotalSize(); maxTotalSize >= 0 && extracted > maxTotalSize {
+		return &ArchiveLimitError{Archive: al.archive, Limit: ArchiveLimitTotalSize}
+	}
+	maxRatio := al.limits.getMaxCompressionRatio()
+	if maxRatio >= 0 && extracted > archiveRatioCheckMinSize && float64(extracted) > maxRatio*float64(al.archiveSize) {
+		return &ArchiveLimitError{Archive: al.archive, Limit: ArchiveLimitCompressionRatio}
+	}
+	return nil
+}
+
+// entry content reader, it stops reading on limits exceeding
+func (al *archiveLimiter) reader(reader io.Reader) io.Reader {
+	return &archiveLimitedReader{limiter: al, reader: reader}
+}
+
+type archiveLimitedReader struct {
+	limiter *archiveLimiter
+	reader  io.Reader
+}
+
+func (alR *archiveLimitedReader) Read(p []byte) (int, error) {
+	n, err := alR.reader.Read(p)
+	alR.limiter.extracted += int64(n)
+	if limitErr := alR.limiter.checkExtractedSize(alR.limiter.extracted); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
+
+/*
+	archive entry path relative to archive root in OS format. Backslashes are treated as separators.
+	Absolute paths, paths with volume names and ".." segments are rejected
+*/
+func getArchiveEntryPath(name string) (string, error) {
+	slashName := strings.ReplaceAll(name, "\\", "/")
+	if slashName == "" || strings.HasPrefix(slashName, "/") || strings.ContainsRune(slashName, 0) ||
+		(len(slashName) > 1 && slashName[1] == ':') {
+		return "", fmt.Errorf("%w: %s", ErrorArchiveEntryPathInvalid, name)
+	}
+	for _, segment := range strings.Split(slashName, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("%w: %s", ErrorArchiveEntryPathInvalid, name)
+		}
+	}
+	entryPath := path.Clean(slashName)
+	if entryPath == "." {
+		return "", fmt.Errorf("%w: %s", ErrorArchiveEntryPathInvalid, name)
+	}
+	return filepath.FromSlash(entryPath), nil
+}
+
+/*
+	check if path is inside dir after symlinks resolving, so symlinks in dir can't redirect files outside.
+	Path could not exist, its deepest existing parent is checked then. Path isn't cleaned, ".." is resolved
+	after previous element symlink
+*/
+func checkPathInsideDir(dir, filePath string) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	existingPath := filePath
+	for {
+		realPath, err := filepath.EvalSymlinks(existingPath)
+		if err == nil {
+			relPath, err := filepath.Rel(realDir, realPath)
+			if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("%w: %s is outside of %s", ErrorArchiveEntryPathInvalid, filePath, dir)
+			}
+			return nil
+		}
+		parentPath := getUncleanParentPath(existingPath)
+		if !os.IsNotExist(err) || parentPath == existingPath {
+			return err
+		}
+		existingPath = parentPath
+	}
+}
+
+// filepath.Dir without cleaning, cleaning drops ".." with previous element before its symlink resolving
+func getUncleanParentPath(filePath string) string {
+	volumeLen := len(filepath.VolumeName(filePath))
+	i := len(filePath)
+	for i > volumeLen && os.IsPathSeparator(filePath[i-1]) {
+		i--
+	}
+	for i > volumeLen && !os.IsPathSeparator(filePath[i-1]) {
+		i--
+	}
+	// root separator is kept
+	for i > volumeLen+1 && os.IsPathSeparator(filePath[i-1]) {
+		i--
+	}
+	if i > volumeLen {
+		return filePath[:i]
+	}
+	if len(filePath) > volumeLen && os.IsPathSeparator(filePath[volumeLen]) {
+		return filePath[:volumeLen+1]
+	}
+	return filePath[:volumeLen] + "."
+}
+
+/*
+	check that symlink target doesn't go through other symlinks of the same update or archive. They aren't created yet,
+	so the OS resolving of such target can't be checked. Target could point to such symlink, its target is checked too
+
+	linkPath - symlink path, links - paths of symlinks, which are created with it
+*/
+func checkSymlinkTargetNotChained(linkPath, target string, links map[string]struct{}) error {
+	components := strings.FieldsFunc(target, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+	curPath := filepath.Dir(linkPath)
+	for i, component := range components {
+		switch component {
+		case ".":
+		case "..":
+			curPath = filepath.Dir(curPath)
+		default:
+			curPath = filepath.Join(curPath, component)
+		}
+		if _, ok := links[curPath]; ok && i < len(components)-1 {
+			return fmt.Errorf("%w: %s -> %s goes through symlink %s", ErrorArchiveEntryPathInvalid, linkPath, target, curPath)
+		}
+	}
+	return nil
+}
+
+/*
+	check if symlink target is inside dir after symlinks resolving
+
+	linkPath - symlink replacement path, tempLinkPath - loaded symlink, links - replacement paths of update symlinks
+*/
+func checkSymlinkTargetInsideDir(dir, linkPath, tempLinkPath string, links map[string]struct{}) error {
+	target, err := os.Readlink(tempLinkPath)
+	if err != nil {
+		return err
+	}
+	err = checkSymlinkTargetNotChained(linkPath, target, links)
+	if err != nil {
+		return err
+	}
+	err = checkPathInsideDir(dir, filepath.Dir(linkPath)+string(filepath.Separator)+target)
+	if errors.Is(err, ErrorArchiveEntryPathInvalid) {
+		return fmt.Errorf("%w: %s -> %s is outside of %s", ErrorArchiveEntryPathInvalid, linkPath, target, dir)
+	}
+	return err
+}
+
+const (
+	// zip "version made by" host systems with unix permissions in external attributes
+	zipCreatorUnix   = 3
+	zipCreatorMacOSX = 19
+	// zip symlink entry content is link target
+	maxSymlinkTargetSize = 4096
+)
+
+/*
+	check archive symlink target. Target should be relative, point inside archive root and not go through
+	other archive symlinks. Its resolving against dest dir is checked on update by checkSymlinkTargetInsideDir
+
+	entryPath - symlink entry path, getArchiveEntryPath result, links - entry paths of all archive symlinks
+*/
+func checkArchiveSymlinkTarget(entryPath, target string, links map[string]struct{}) error {
+	slashTarget := strings.ReplaceAll(target, "\\", "/")
+	if slashTarget == "" || strings.HasPrefix(slashTarget, "/") || strings.ContainsRune(slashTarget, 0) ||
+		(len(slashTarget) > 1 && slashTarget[1] == ':') {
+		return fmt.Errorf("%w: %s -> %s", ErrorArchiveEntryPathInvalid, entryPath, target)
+	}
+	resolvedPath := path.Join(path.Dir(filepath.ToSlash(entryPath)), slashTarget)
+	if resolvedPath == ".." || strings.HasPrefix(resolvedPath, "../") {
+		return fmt.Errorf("%w: %s -> %s", ErrorArchiveEntryPathInvalid, entryPath, target)
+	}
+	return checkSymlinkTargetNotChained(entryPath, target, links)
+}
+
+/*
+	create symlink to target in loader dest dir. Target is checked by checkArchiveSymlinkTarget
+	after archive unpacking, when all archive symlinks are known
+*/
+func (vfl versionFilesLoader) writeTempSymlinkToDir(target, filename string) (string, error) {
+	// temp file reserves unique name
+	tFile, err := os.CreateTemp(vfl.destDir, fmt.Sprintf("update-file-*-%s", filename))
+	if err != nil {
+		return "", err
+	}
+	err = tFile.Close()
+	if err == nil {
+		err = os.Remove(tFile.Name())
+	}
+	if err != nil {
+		return "", err
+	}
+	return tFile.Name(), os.Symlink(filepath.FromSlash(strings.ReplaceAll(target, "\\", "/")), tFile.Name())
+}
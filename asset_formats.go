@@ -0,0 +1,309 @@
+package updaterini
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const ZipArchiveExtension = ".zip"
+
+const TarArchiveExtension = ".tar"
+
+var (
+	TarGzArchiveExtensions  = []string{".tgz", ".tar.gz"}
+	TarXzArchiveExtensions  = []string{".txz", ".tar.xz"}
+	TarZstArchiveExtensions = []string{".tzst", ".tar.zst"}
+	TarBz2ArchiveExtensions = []string{".tbz2", ".tar.bz2"}
+)
+
+// single compressed file extensions, decompressed file name is asset filename without extension
+const (
+	GzFileExtension  = ".gz"
+	XzFileExtension  = ".xz"
+	ZstFileExtension = ".zst"
+	Bz2FileExtension = ".bz2"
+)
+
+const errorZipArchiveIsNotSeekable = "zip archive content should be seekable file, it can't be compressed"
+
+/*
+	ArchiveEntry describes archive entry. Mode contains entry type (fs.ModeDir, fs.ModeSymlink etc.),
+	hardlinks have regular file type
+*/
+type ArchiveEntry struct {
+	Name       string      // entry path inside archive
+	Size       int64       // entry content size from archive header
+	Mode       fs.FileMode // entry type and permission
+	HasPerm    bool        // Mode permission is set by archive, archive is created on system with unix permissions
+	ModTime    time.Time   // zero if archive doesn't provide it
+	Linkname   string      // symlink target or linked entry name of hardlink
+	IsHardlink bool
+}
+
+// ArchiveReader reads archive entries one by one
+type ArchiveReader interface {
+	Next() (ArchiveEntry, error) // move to next entry, io.EOF after the last entry
+	Read(p []byte) (int, error)  // read current entry content
+	Close() error
+}
+
+/*
+	Unarchiver opens archive content. Content is decompressed asset file,
+	it's *os.File (seekable) if asset format has no decompressor
+*/
+type Unarchiver func(content io.Reader) (ArchiveReader, error)
+
+// Decompressor opens decompressed content reader. Library closes returned reader, but not content
+type Decompressor func(content io.Reader) (io.ReadCloser, error)
+
+/*
+	AssetFormat describes asset content format. Asset is unpacked if its filename has format extension or
+	if UpdateConfig.DetectAssetsFormatsByContent is true and its content starts with format magic bytes.
+	Asset is decompressed with Decompress, than unarchived with Unarchive. Asset is single compressed file if Unarchive is nil
+*/
+type AssetFormat struct {
+	Name        string       // unique format name, registered format with the same name is replaced
+	Extensions  []string     // asset filename extensions, the longest matched extension wins. Extensions are matched case-insensitively
+	Magic       []byte       // optional content magic bytes
+	MagicOffset int          // magic bytes offset in content
+	Decompress  Decompressor // optional content decompressor
+	Unarchive   Unarchiver   // optional content unarchiver
+}
+
+var (
+	assetFormatsMu sync.RWMutex
+	assetFormats   = []AssetFormat{
+		{Name: "zip", Extensions: []string{ZipArchiveExtension}, Magic: []byte("PK\x03\x04"), Unarchive: NewZipArchiveReader},
+		{Name: "tar", Extensions: []string{TarArchiveExtension}, Magic: []byte("ustar"), MagicOffset: 257, Unarchive: NewTarArchiveReader},
+		{Name: "tar.gz", Extensions: TarGzArchiveExtensions, Decompress: decompressGz, Unarchive: NewTarArchiveReader},
+		{Name: "tar.xz", Extensions: TarXzArchiveExtensions, Decompress: decompressXz, Unarchive: NewTarArchiveReader},
+		{Name: "tar.zst", Extensions: TarZstArchiveExtensions, Decompress: decompressZst, Unarchive: NewTarArchiveReader},
+		{Name: "tar.bz2", Extensions: TarBz2ArchiveExtensions, Decompress: decompressBz2, Unarchive: NewTarArchiveReader},
+		{Name: "gz", Extensions: []string{GzFileExtension}, Magic: []byte{0x1f, 0x8b}, Decompress: decompressGz},
+		{Name: "xz", Extensions: []string{XzFileExtension}, Magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, Decompress: decompressXz},
+		{Name: "zst", Extensions: []string{ZstFileExtension}, Magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, Decompress: decompressZst},
+		{Name: "bz2", Extensions: []string{Bz2FileExtension}, Magic: []byte("BZh"), Decompress: decompressBz2},
+	}
+)
+
+// RegisterAssetFormat adds asset format or replaces registered format with the same name
+func RegisterAssetFormat(format AssetFormat) {
+	assetFormatsMu.Lock()
+	defer assetFormatsMu.Unlock()
+	for i := range assetFormats {
+		if assetFormats[i].Name == format.Name {
+			assetFormats[i] = format
+			return
+		}
+	}
+	assetFormats = append(assetFormats, format)
+}
+
+// asset format by the longest matched extension, matched extension is returned too
+func getAssetFormatByFilename(filename string) (AssetFormat, string, bool) {
+	assetFormatsMu.RLock()
+	defer assetFormatsMu.RUnlock()
+	lowerFilename := strings.ToLower(filename)
+	var result AssetFormat
+	var resultExt string
+	for _, format := range assetFormats {
+		for _, ext := range format.Extensions {
+			if len(ext) > len(resultExt) && strings.HasSuffix(lowerFilename, strings.ToLower(ext)) {
+				result, resultExt = format, ext
+			}
+		}
+	}
+	return result, filename[:len(filename)-len(resultExt)], resultExt != ""
+}
+
+// asset format by content magic bytes
+func getAssetFormatByContent(fPath string) (_ AssetFormat, _ bool, err error) {
+	assetFormatsMu.RLock()
+	defer assetFormatsMu.RUnlock()
+	headerSize := 0
+	for _, format := range assetFormats {
+		if size := format.MagicOffset + len(format.Magic); len(format.Magic) != 0 && size > headerSize {
+			headerSize = size
+		}
+	}
+	file, err := os.Open(fPath)
+	if err != nil {
+		return AssetFormat{}, false, err
+	}
+	defer func() {
+		tmpErr := file.Close()
+		if err == nil {
+			err = tmpErr
+		}
+	}()
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return AssetFormat{}, false, err
+	}
+	header = header[:n]
+	for _, format := range assetFormats {
+		if len(format.Magic) != 0 && len(header) >= format.MagicOffset+len(format.Magic) &&
+			bytes.Equal(header[format.MagicOffset:format.MagicOffset+len(format.Magic)], format.Magic) {
+			return format, true, nil
+		}
+	}
+	return AssetFormat{}, false, nil
+}
+
+func decompressGz(content io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(content)
+}
+
+func decompressXz(content io.Reader) (io.ReadCloser, error) {
+	reader, err := xz.NewReader(content)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(reader), nil
+}
+
+func decompressZst(content io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(content, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+func decompressBz2(content io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(bzip2.NewReader(content)), nil
+}
+
+type tarArchiveReader struct {
+	reader *tar.Reader
+}
+
+// NewTarArchiveReader is tar Unarchiver
+func NewTarArchiveReader(content io.Reader) (ArchiveReader, error) {
+	return tarArchiveReader{reader: tar.NewReader(content)}, nil
+}
+
+func (tAR tarArchiveReader) Next() (ArchiveEntry, error) {
+	hdr, err := tAR.reader.Next()
+	if err != nil {
+		return ArchiveEntry{}, err
+	}
+	return ArchiveEntry{
+		Name:       hdr.Name,
+		Size:       hdr.Size,
+		Mode:       hdr.FileInfo().Mode(),
+		HasPerm:    true,
+		ModTime:    hdr.ModTime,
+		Linkname:   hdr.Linkname,
+		IsHardlink: hdr.Typeflag == tar.TypeLink,
+	}, nil
+}
+
+func (tAR tarArchiveReader) Read(p []byte) (int, error) {
+	return tAR.reader.Read(p)
+}
+
+func (tAR tarArchiveReader) Close() error {
+	return nil
+}
+
+type zipArchiveReader struct {
+	reader  *zip.Reader
+	index   int
+	file    *zip.File     // current entry
+	current io.ReadCloser // current entry content, opened on first read
+}
+
+/*
+	NewZipArchiveReader is zip Unarchiver. Content should be seekable file (io.ReaderAt with Stat method)
+*/
+func NewZipArchiveReader(content io.Reader) (ArchiveReader, error) {
+	file, ok := content.(interface {
+		io.ReaderAt
+		Stat() (fs.FileInfo, error)
+	})
+	if !ok {
+		return nil, errors.New(errorZipArchiveIsNotSeekable)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zR, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	return &zipArchiveReader{reader: zR}, nil
+}
+
+func (zAR *zipArchiveReader) Next() (ArchiveEntry, error) {
+	err := zAR.closeCurrent()
+	if err != nil {
+		return ArchiveEntry{}, err
+	}
+	if zAR.index >= len(zAR.reader.File) {
+		return ArchiveEntry{}, io.EOF
+	}
+	zAR.file = zAR.reader.File[zAR.index]
+	zAR.index++
+	entry := ArchiveEntry{
+		Name:    zAR.file.Name,
+		Size:    int64(zAR.file.UncompressedSize64),
+		Mode:    zAR.file.Mode(),
+		ModTime: zAR.file.Modified,
+	}
+	// permissions of archives created on other systems are unknown
+	if creator := zAR.file.CreatorVersion >> 8; creator == zipCreatorUnix || creator == zipCreatorMacOSX {
+		entry.HasPerm = true
+	}
+	if entry.Mode&fs.ModeSymlink != 0 {
+		// zip symlink content is link target
+		target, err := io.ReadAll(io.LimitReader(zAR, maxSymlinkTargetSize))
+		if err != nil {
+			return ArchiveEntry{}, err
+		}
+		entry.Linkname = string(target)
+	}
+	return entry, nil
+}
+
+func (zAR *zipArchiveReader) Read(p []byte) (int, error) {
+	if zAR.current == nil {
+		if zAR.file == nil {
+			return 0, io.EOF
+		}
+		var err error
+		zAR.current, err = zAR.file.Open()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return zAR.current.Read(p)
+}
+
+func (zAR *zipArchiveReader) closeCurrent() error {
+	if zAR.current == nil {
+		return nil
+	}
+	err := zAR.current.Close()
+	zAR.current = nil
+	return err
+}
+
+func (zAR *zipArchiveReader) Close() error {
+	return zAR.closeCurrent()
+}
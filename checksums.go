@@ -0,0 +1,67 @@
+package updaterini
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrorAssetChecksumMismatch = errors.New("error. asset checksum mismatch")
+
+const (
+	errorChecksumInvalid         = "checksum is invalid (sha256 hex expected)"
+	errorChecksumsFileInvalid    = "checksums file is invalid"
+	errorChecksumsFileNotFound   = "checksums file not found"
+	errorChecksumNotFoundForFile = "checksum not found for asset"
+)
+
+func parseSHA256Checksum(checksum string) ([]byte, error) {
+	digest, err := hex.DecodeString(strings.TrimSpace(checksum))
+	if err != nil || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("%s: %s", checksum, errorChecksumInvalid)
+	}
+	return digest, nil
+}
+
+/*
+	parse checksums file in sha256sum output format, one asset per line:
+
+	<sha256 hex>  <filename>
+
+	<sha256 hex> *<filename>
+*/
+func parseChecksumsFile(reader io.Reader) (map[string][]byte, error) {
+	checksums := make(map[string][]byte)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s: %s", errorChecksumsFileInvalid, line)
+		}
+		digest, err := parseSHA256Checksum(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", errorChecksumsFileInvalid, err)
+		}
+		checksums[strings.TrimPrefix(fields[1], "*")] = digest
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return checksums, nil
+}
+
+func verifyChecksum(filename string, expected, actual []byte) error {
+	if expected == nil || bytes.Equal(expected, actual) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s (expected %x, actual %x)", ErrorAssetChecksumMismatch, filename, expected, actual)
+}
@@ -10,6 +10,11 @@ require (
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
+	github.com/klauspost/compress v1.15.15 // indirect
 	github.com/russross/blackfriday/v2 v2.0.1 // indirect
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
+	github.com/ulikunitz/xz v0.5.15 // indirect
 )
+
+// local development only, library version above is used after replace removing
+replace github.com/GrigoryKrasnochub/updaterini => ../../
@@ -7,12 +7,12 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/GrigoryKrasnochub/updaterini"
 	"github.com/urfave/cli/v2"
 )
 
-const descriptionNameSeparator = "====="
-const descriptionFilename = "description.txt"
 const outputFilename = "serv_update.json"
 
 func main() {
@@ -34,14 +34,14 @@ func main() {
 					&cli.StringFlag{
 						Name:    "descFilename",
 						Aliases: []string{"d"},
-						Value:   descriptionFilename,
+						Value:   updaterini.DefaultDescriptionFilename,
 						Usage: "filename in version folder, that contains version description, " +
 							"will be parsed and skipped in assets. Parsed description will be used in result json file",
 					},
 					&cli.StringFlag{
 						Name:    "descNameSeparator",
 						Aliases: []string{"s"},
-						Value:   descriptionNameSeparator,
+						Value:   updaterini.DefaultDescriptionNameSeparator,
 						Usage:   "separator that separate version name from version description in version description file",
 					},
 					&cli.PathFlag{
@@ -50,6 +50,16 @@ func main() {
 						Required: true,
 						Usage:    "path to versions folder",
 					},
+					&cli.DurationFlag{
+						Name:    "expiresIn",
+						Aliases: []string{"e"},
+						Usage:   "updates map expiry period from generation date (720h), updates map doesn't expire if it's not set. Required for signed updates map",
+					},
+					&cli.Int64Flag{
+						Name:    "serial",
+						Aliases: []string{"sn"},
+						Usage:   "updates map serial, it must increase with every generation. Generation unix time is used if it's not set",
+					},
 					&cli.PathFlag{
 						Name:    "outputFilepath",
 						Aliases: []string{"of"},
@@ -81,11 +91,25 @@ func main() {
 					if !strings.HasSuffix(baseUrl, "/") {
 						baseUrl += "/"
 					}
+					manifest := updaterini.ServManifest{
+						SchemaVersion: updaterini.ServManifestSchemaVersion,
+						GeneratedAt:   time.Now().UTC().Truncate(time.Second),
+						Versions:      make([]updaterini.ServData, len(versions)),
+					}
+					manifest.Serial = uint64(manifest.GeneratedAt.Unix())
+					if serial := context.Int64("serial"); serial > 0 {
+						manifest.Serial = uint64(serial)
+					}
+					if expiresIn := context.Duration("expiresIn"); expiresIn > 0 {
+						expiresAt := manifest.GeneratedAt.Add(expiresIn)
+						manifest.ExpiresAt = &expiresAt
+					}
 					for i, ver := range versions {
-						versions[i].VersionFolderUrl = baseUrl + ver.Version + "/"
+						manifest.Versions[i] = ver.ServData
+						manifest.Versions[i].VersionFolderUrl = baseUrl + ver.Version + "/"
 					}
 
-					jsonVersions, err := json.Marshal(versions)
+					jsonVersions, err := json.Marshal(manifest)
 					if err != nil {
 						return err
 					}
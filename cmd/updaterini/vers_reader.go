@@ -1,12 +1,13 @@
 package main
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/GrigoryKrasnochub/updaterini"
 	"github.com/blang/semver/v4"
@@ -62,25 +63,48 @@ func (vr verReader) readVersionDir(vDirPath string) (servExtData, error) {
 			if err != nil {
 				return sData, err
 			}
-			sData.Name = strings.TrimSpace(name)
-			sData.Description = strings.TrimSpace(description)
+			sData.Name = name
+			sData.Description = description
 			continue
 		}
 		sData.Version = filepath.Base(vDirPath)
-		sData.Assets = append(sData.Assets, struct {
-			Filename string "json:\"filename\""
-		}{Filename: asset.Name()})
+		checksum, err := vr.readAssetChecksum(filepath.Join(vDirPath, asset.Name()))
+		if err != nil {
+			return sData, err
+		}
+		sData.Assets = append(sData.Assets, updaterini.ServAsset{
+			Filename: asset.Name(),
+			Size:     asset.Size(),
+			SHA256:   checksum,
+		})
 	}
 	return sData, nil
 }
 
+func (vr verReader) readAssetChecksum(filepath string) (_ string, err error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return "", fmt.Errorf("reading asset error: %v", err)
+	}
+	defer func() {
+		closeErr := file.Close()
+		if err == nil && closeErr != nil {
+			err = fmt.Errorf("closing asset error: %v", closeErr)
+		}
+	}()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("reading asset error: %v", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func (vr verReader) readVersionDescriptionFile(filepath string) (name string, description string, _ error) {
 	desc, err := os.ReadFile(filepath)
 	if err != nil {
 		return "", "", fmt.Errorf("reading description error: %v", err)
 	}
-	if delimIndex := bytes.Index(desc, []byte(vr.descriptionNameSeparator)); delimIndex != -1 {
-		return string(desc[0:delimIndex]), string(desc[delimIndex+len(vr.descriptionNameSeparator):]), nil
-	}
-	return "", string(desc), nil
+	name, description = updaterini.ParseVersionDescription(desc, vr.descriptionNameSeparator)
+	return name, description, nil
 }
@@ -0,0 +1,160 @@
+package updaterini
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// cached response of conditional request
+type conditionalResponse struct {
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         []byte      `json:"body"`
+}
+
+/*
+	cache of source responses. Responses are revalidated with If-None-Match/If-Modified-Since headers,
+	on 304 Not Modified cached body is used. Cache is persisted to filePath if it's set
+*/
+type conditionalCache struct {
+	mu        sync.Mutex
+	filePath  string
+	responses map[string]conditionalResponse
+}
+
+var conditionalCacheInitMu sync.Mutex
+
+/*
+	lazy cache initialization for sources created with struct literal
+
+	filePath - cache file, in-memory cache on empty
+*/
+func getConditionalCache(cache **conditionalCache, filePath string) *conditionalCache {
+	conditionalCacheInitMu.Lock()
+	defer conditionalCacheInitMu.Unlock()
+	if *cache == nil || (*cache).filePath != filePath {
+		*cache = &conditionalCache{filePath: filePath}
+	}
+	return *cache
+}
+
+// load persisted cache on first use, broken cache file is ignored
+func (cc *conditionalCache) load() {
+	if cc.responses != nil {
+		return
+	}
+	cc.responses = make(map[string]conditionalResponse)
+	if cc.filePath == "" {
+		return
+	}
+	content, err := os.ReadFile(cc.filePath)
+	if err != nil {
+		return
+	}
+	var responses map[string]conditionalResponse
+	if json.Unmarshal(content, &responses) == nil && responses != nil {
+		cc.responses = responses
+	}
+}
+
+func (cc *conditionalCache) get(url string) (conditionalResponse, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.load()
+	resp, ok := cc.responses[url]
+	return resp, ok
+}
+
+func (cc *conditionalCache) set(url string, resp conditionalResponse) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.load()
+	cc.responses[url] = resp
+	if cc.filePath == "" {
+		return nil
+	}
+	content, err := json.Marshal(cc.responses)
+	if err != nil {
+		return err
+	}
+	return replaceFileContent(cc.filePath, content)
+}
+
+// write content to temp file and rename it to filePath, so concurrent readers never see partial file
+func replaceFileContent(filePath string, content []byte) error {
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		return err
+	}
+	tempFilePath := filePath + ".tmp"
+	err = os.WriteFile(tempFilePath, content, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempFilePath, filePath)
+}
+
+/*
+	do request and read full response body. Cached response is used if server answers 304 Not Modified,
+	notModified is true then
+
+	cache - could be nil, request is not conditional then
+*/
+func doConditionalGetRequest(ctx context.Context, url string, appConfig ApplicationConfig, httpConfig HTTPConfig, customHeaders map[string]string,
+	cache *conditionalCache, onAttempt func(RequestAttempt)) (_ conditionalResponse, notModified bool, err error) {
+	headers := make(map[string]string, len(customHeaders)+2)
+	for key, header := range customHeaders {
+		headers[key] = header
+	}
+	var cached conditionalResponse
+	var hasCached bool
+	if cache != nil {
+		cached, hasCached = cache.get(url)
+	}
+	if hasCached {
+		if cached.ETag != "" {
+			headers["If-None-Match"] = cached.ETag
+		}
+		if cached.LastModified != "" {
+			headers["If-Modified-Since"] = cached.LastModified
+		}
+	}
+	resp, err := doGetRequest(ctx, url, appConfig, httpConfig, headers,
+		map[int]interface{}{http.StatusOK: struct{}{}, http.StatusNotModified: struct{}{}}, onAttempt)
+	if err != nil {
+		return conditionalResponse{}, false, err
+	}
+	defer func() {
+		tmpErr := resp.Body.Close()
+		if err == nil {
+			err = tmpErr
+		}
+	}()
+	if resp.StatusCode == http.StatusNotModified {
+		if !hasCached {
+			return conditionalResponse{}, false, &ResponseCodeError{URL: url, StatusCode: resp.StatusCode, Header: resp.Header}
+		}
+		return cached, true, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return conditionalResponse{}, false, err
+	}
+	result := conditionalResponse{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Header:       resp.Header.Clone(),
+		Body:         body,
+	}
+	if cache != nil && (result.ETag != "" || result.LastModified != "") {
+		// response is valid even if it's not cached
+		_ = cache.set(url, result)
+	}
+	return result, false, nil
+}
@@ -2,4 +2,8 @@ module github.com/GrigoryKrasnochub/updaterini
 
 go 1.17
 
-require github.com/blang/semver/v4 v4.0.0
+require (
+	github.com/blang/semver/v4 v4.0.0
+	github.com/klauspost/compress v1.15.15
+	github.com/ulikunitz/xz v0.5.15
+)
@@ -0,0 +1,309 @@
+package updaterini
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrorManifestInvalid           = errors.New("error. updates map is invalid")
+	ErrorManifestSchemaUnsupported = errors.New("error. updates map schema version is unsupported")
+	ErrorManifestUnknownField      = errors.New("error. updates map has unknown field")
+	ErrorManifestExpired           = errors.New("error. updates map is expired")
+	ErrorManifestRollback          = errors.New("error. updates map serial is older than already seen serial")
+	ErrorManifestExpiryMissing     = errors.New("error. signed updates map has no expiry date")
+	ErrorManifestSerialMissing     = errors.New("error. signed updates map has no serial")
+)
+
+// ServManifestSchemaVersion is the latest updates map schema version supported by library
+const ServManifestSchemaVersion = 1
+
+const (
+	errorManifestSchemaVersionIsMissing = "schema_version is missing"
+	errorManifestVersionTagIsEmpty      = "version tag is empty"
+	errorManifestAssetFilenameIsEmpty   = "asset filename is empty"
+	errorManifestAssetSizeInvalid       = "asset size is negative"
+	errorManifestAssetUrlInvalid        = "asset url is not absolute url"
+)
+
+/*
+	ServManifest is updates map of UpdateSourceServer. Legacy updates map (bare ServData array)
+	is parsed as manifest with schema version 0
+*/
+type ServManifest struct {
+	SchemaVersion int        `json:"schema_version"`       // updates map format version, ServManifestSchemaVersion
+	Serial        uint64     `json:"serial,omitempty"`     // updates map serial, it increases with every updates map generation. Required for signed updates map
+	GeneratedAt   time.Time  `json:"generated_at"`         // updates map generation date
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"` // updates map expiry date. Required for signed updates map
+	Versions      []ServData `json:"versions"`
+}
+
+// envelope with raw versions, versions are parsed one by one
+type servManifestEnvelope struct {
+	SchemaVersion *int              `json:"schema_version"`
+	Serial        uint64            `json:"serial"`
+	GeneratedAt   time.Time         `json:"generated_at"`
+	ExpiresAt     *time.Time        `json:"expires_at"`
+	Versions      []json.RawMessage `json:"versions"`
+}
+
+/*
+	ParseServManifest parses updates map in legacy (ServData array) or envelope format.
+	Invalid versions are skipped, they are returned in warnings with unknown fields (non-critical errors).
+	err is returned if updates map can't be parsed at all or its schema version is unsupported
+*/
+func ParseServManifest(content []byte) (manifest ServManifest, warnings []error, err error) {
+	content = bytes.TrimSpace(content)
+	var rawVersions []json.RawMessage
+	if bytes.HasPrefix(content, []byte("[")) {
+		err = json.Unmarshal(content, &rawVersions)
+		if err != nil {
+			return ServManifest{}, nil, fmt.Errorf("%w: %v", ErrorManifestInvalid, err)
+		}
+	} else {
+		var envelope servManifestEnvelope
+		err = json.Unmarshal(content, &envelope)
+		if err != nil {
+			return ServManifest{}, nil, fmt.Errorf("%w: %v", ErrorManifestInvalid, err)
+		}
+		if envelope.SchemaVersion == nil {
+			return ServManifest{}, nil, fmt.Errorf("%w: %s", ErrorManifestInvalid, errorManifestSchemaVersionIsMissing)
+		}
+		if *envelope.SchemaVersion < 1 || *envelope.SchemaVersion > ServManifestSchemaVersion {
+			return ServManifest{}, nil, fmt.Errorf("%w: %d", ErrorManifestSchemaUnsupported, *envelope.SchemaVersion)
+		}
+		manifest = ServManifest{
+			SchemaVersion: *envelope.SchemaVersion,
+			Serial:        envelope.Serial,
+			GeneratedAt:   envelope.GeneratedAt,
+			ExpiresAt:     envelope.ExpiresAt,
+		}
+		rawVersions = envelope.Versions
+		// versions are checked below
+		for _, field := range findUnknownJSONFields(content, reflect.TypeOf(envelope), "") {
+			warnings = append(warnings, fmt.Errorf("%w: %s", ErrorManifestUnknownField, field))
+		}
+	}
+
+	for i, rawVersion := range rawVersions {
+		path := fmt.Sprintf("versions[%d]", i)
+		for _, field := range findUnknownJSONFields(rawVersion, reflect.TypeOf(ServData{}), path) {
+			warnings = append(warnings, fmt.Errorf("%w: %s", ErrorManifestUnknownField, field))
+		}
+		var data ServData
+		err = json.Unmarshal(rawVersion, &data)
+		if err == nil {
+			err = validateServData(data)
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("%w: %s: %v", ErrorManifestInvalid, path, err))
+			continue
+		}
+		manifest.Versions = append(manifest.Versions, data)
+	}
+	return manifest, warnings, nil
+}
+
+/*
+	reject expired updates map and, if ApplicationConfig has trusted keys, signed updates map without expiry date
+	or serial and with serial older than the highest serial seen for sourceKey. Updates map serial is saved
+	as the highest one on success. Serials of unsigned updates maps are not saved, anyone could generate them
+*/
+func checkManifestFreshness(cfg ApplicationConfig, sourceKey string, manifest ServManifest, now time.Time) error {
+	if manifest.ExpiresAt != nil && now.After(*manifest.ExpiresAt) {
+		return fmt.Errorf("%w: expired at %s", ErrorManifestExpired, manifest.ExpiresAt.Format(time.RFC3339))
+	}
+	if !cfg.isSignatureRequired() {
+		return nil
+	}
+	// signed updates map without expiry date could be replayed forever, legacy updates map has no serial
+	if manifest.ExpiresAt == nil {
+		return ErrorManifestExpiryMissing
+	}
+	if manifest.Serial == 0 {
+		return ErrorManifestSerialMissing
+	}
+	return getManifestSerials(cfg.ManifestStateFile).update(sourceKey, manifest.Serial)
+}
+
+// the highest seen serials of signed updates maps by source key
+type manifestSerials struct {
+	mu       sync.Mutex
+	filePath string
+	serials  map[string]uint64
+}
+
+var (
+	manifestSerialsMu     sync.Mutex
+	manifestSerialsByFile = make(map[string]*manifestSerials)
+)
+
+/*
+	serials are shared by all sources with the same state file
+
+	filePath - state file, serials are kept in memory on empty
+*/
+func getManifestSerials(filePath string) *manifestSerials {
+	manifestSerialsMu.Lock()
+	defer manifestSerialsMu.Unlock()
+	serials, ok := manifestSerialsByFile[filePath]
+	if !ok {
+		serials = &manifestSerials{filePath: filePath}
+		manifestSerialsByFile[filePath] = serials
+	}
+	return serials
+}
+
+/*
+	load state file on first use. Broken or missing state file is treated as empty,
+	it's not possible to distinguish it from the first application run
+*/
+func (ms *manifestSerials) load() {
+	if ms.serials != nil {
+		return
+	}
+	ms.serials = make(map[string]uint64)
+	if ms.filePath == "" {
+		return
+	}
+	content, err := os.ReadFile(ms.filePath)
+	if err != nil {
+		return
+	}
+	var serials map[string]uint64
+	if json.Unmarshal(content, &serials) == nil && serials != nil {
+		ms.serials = serials
+	}
+}
+
+func (ms *manifestSerials) update(sourceKey string, serial uint64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.load()
+	seenSerial := ms.serials[sourceKey]
+	if serial < seenSerial {
+		return fmt.Errorf("%w: serial %d, seen serial %d", ErrorManifestRollback, serial, seenSerial)
+	}
+	if serial == seenSerial {
+		return nil
+	}
+	ms.serials[sourceKey] = serial
+	if ms.filePath == "" {
+		return nil
+	}
+	content, err := json.Marshal(ms.serials)
+	if err != nil {
+		return err
+	}
+	return replaceFileContent(ms.filePath, content)
+}
+
+func validateServData(data ServData) error {
+	if data.Version == "" {
+		return errors.New(errorManifestVersionTagIsEmpty)
+	}
+	for _, asset := range data.Assets {
+		if asset.Filename == "" {
+			return fmt.Errorf("%s: %s", data.Version, errorManifestAssetFilenameIsEmpty)
+		}
+		if asset.SHA256 != "" {
+			if _, err := parseSHA256Checksum(asset.SHA256); err != nil {
+				return fmt.Errorf("%s: %w (%s)", data.Version, err, asset.Filename)
+			}
+		}
+		if asset.Size < 0 {
+			return fmt.Errorf("%s: %s (%s)", data.Version, errorManifestAssetSizeInvalid, asset.Filename)
+		}
+		if asset.URL != "" {
+			if assetUrl, err := url.Parse(asset.URL); err != nil || !assetUrl.IsAbs() {
+				return fmt.Errorf("%s: %s (%s)", data.Version, errorManifestAssetUrlInvalid, asset.Filename)
+			}
+		}
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+/*
+	json object fields, that are not fields of type t. Nested objects and arrays are checked too.
+	Fields are matched case-insensitively like encoding/json does
+
+	path - content path prefix for result fields
+*/
+func findUnknownJSONFields(content []byte, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var unknownFields []string
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == timeType {
+			return nil
+		}
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(content, &fields) != nil {
+			return nil
+		}
+		for name, value := range fields {
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			field, ok := findJSONField(t, name)
+			if !ok {
+				unknownFields = append(unknownFields, fieldPath)
+				continue
+			}
+			unknownFields = append(unknownFields, findUnknownJSONFields(value, field.Type, fieldPath)...)
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(content, &items) != nil {
+			return nil
+		}
+		for i, item := range items {
+			unknownFields = append(unknownFields, findUnknownJSONFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		var items map[string]json.RawMessage
+		if json.Unmarshal(content, &items) != nil {
+			return nil
+		}
+		for key, item := range items {
+			unknownFields = append(unknownFields, findUnknownJSONFields(item, t.Elem(), path+"."+key)...)
+		}
+	}
+	sort.Strings(unknownFields)
+	return unknownFields
+}
+
+// exported struct field by json name
+func findJSONField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if fieldName == "-" {
+			continue
+		}
+		if fieldName == "" {
+			fieldName = field.Name
+		}
+		if strings.EqualFold(fieldName, name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
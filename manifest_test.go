@@ -0,0 +1,155 @@
+package updaterini
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseServManifest(t *testing.T) {
+	const validChecksum = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	for _, test := range []struct {
+		name           string
+		manifest       string
+		schemaVersion  int
+		versionsCount  int
+		warningsCount  int
+		expectedErr    error
+		unknownWarning bool
+	}{
+		{name: "legacy", manifest: `[{"folder_url":"/","version":"1.0.1","assets":[{"filename":"app_file"}]}]`, versionsCount: 1},
+		{name: "envelope", manifest: `{"schema_version":1,"generated_at":"2022-03-01T10:00:00Z","expires_at":"2022-04-01T10:00:00Z",
+			"versions":[{"folder_url":"/","version":"1.0.1","assets":[{"filename":"app_file","sha256":"` + validChecksum + `"}]}]}`, schemaVersion: 1, versionsCount: 1},
+		{name: "unknown fields", manifest: `{"schema_version":1,"mirror":"x","versions":[{"folder_url":"/","version":"1.0.1","Name":"n",
+			"assets":[{"filename":"app_file","arch":"amd64"}]}]}`, schemaVersion: 1, versionsCount: 1, warningsCount: 2, unknownWarning: true},
+		{name: "invalid versions", manifest: `{"schema_version":1,"versions":[{"folder_url":"/","version":"1.0.1","assets":[{"filename":"app_file","sha256":"abc"}]},
+			{"folder_url":"/","version":"1.0.2","assets":[{"filename":"app_file","size":"big"}]},
+			{"folder_url":"/","version":"1.0.3","assets":[{"filename":"app_file","url":"/relative"}]},
+			{"folder_url":"/","version":"1.0.4","assets":[{"filename":"app_file"}]}]}`, schemaVersion: 1, versionsCount: 1, warningsCount: 3},
+		{name: "missing schema version", manifest: `{"versions":[]}`, expectedErr: ErrorManifestInvalid},
+		{name: "unsupported schema version", manifest: `{"schema_version":2,"versions":[]}`, expectedErr: ErrorManifestSchemaUnsupported},
+		{name: "broken", manifest: `{"schema_version":1,"versions":{}}`, expectedErr: ErrorManifestInvalid},
+	} {
+		manifest, warnings, err := ParseServManifest([]byte(test.manifest))
+		if !errors.Is(err, test.expectedErr) || (test.expectedErr == nil) != (err == nil) {
+			t.Errorf("%s: parse err: expected %v, fact %v", test.name, test.expectedErr, err)
+			continue
+		}
+		if manifest.SchemaVersion != test.schemaVersion || len(manifest.Versions) != test.versionsCount || len(warnings) != test.warningsCount {
+			t.Errorf("%s: manifest err: schema %d, versions %d, warnings %v", test.name, manifest.SchemaVersion, len(manifest.Versions), warnings)
+		}
+		for _, warning := range warnings {
+			if errors.Is(warning, ErrorManifestUnknownField) != test.unknownWarning {
+				t.Errorf("%s: warning err: %s", test.name, warning)
+			}
+		}
+	}
+}
+
+func TestServerSourceManifestWarnings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"schema_version":1,"channel":"beta","versions":[{"folder_url":"/","version":"1.0.1","assets":[{"filename":"app_file"}]}]}`))
+	}))
+	defer server.Close()
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	source := UpdateSourceServer{UpdatesMapURL: server.URL}
+	// warnings are non-critical errors, they are hidden by default
+	versions, srcStatus := source.SourceVersions(context.Background(), cfg)
+	if srcStatus.Status != CheckSuccess || len(versions) != 1 || len(srcStatus.Errors) != 0 {
+		t.Errorf("check err: %v, %v, %v", srcStatus.Status, versions, srcStatus.Errors)
+	}
+	cfg.ShowPrepareVersionErr = true
+	versions, srcStatus = source.SourceVersions(context.Background(), cfg)
+	if srcStatus.Status != CheckHasErrors || len(versions) != 1 || len(srcStatus.Errors) != 1 || !errors.Is(srcStatus.Errors[0], ErrorManifestUnknownField) {
+		t.Errorf("check err: %v, %v, %v", srcStatus.Status, versions, srcStatus.Errors)
+	}
+}
+
+func TestServerSourceManifestFreshness(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key err: %s", err)
+	}
+	var manifest []byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(manifest)
+	})
+	mux.HandleFunc("/manifest.json.sig", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(ed25519.Sign(privateKey, manifest))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	tempDir, err := ioutil.TempDir("", "tsmf-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	cfg.TrustedPublicKeys = []ed25519.PublicKey{publicKey}
+	cfg.ManifestStateFile = filepath.Join(tempDir, "manifest_state.json")
+	source := UpdateSourceServer{UpdatesMapURL: server.URL + "/manifest.json"}
+
+	expired := time.Now().Add(-time.Hour)
+	expiresAt := time.Now().Add(time.Hour)
+	for _, test := range []struct {
+		name        string
+		serial      uint64
+		expiresAt   *time.Time
+		legacy      bool
+		expectedErr error
+	}{
+		{name: "first serial", serial: 5, expiresAt: &expiresAt},
+		{name: "same serial", serial: 5, expiresAt: &expiresAt},
+		{name: "newer serial", serial: 7, expiresAt: &expiresAt},
+		{name: "rollback", serial: 6, expiresAt: &expiresAt, expectedErr: ErrorManifestRollback},
+		{name: "expired", serial: 8, expiresAt: &expired, expectedErr: ErrorManifestExpired},
+		{name: "missing expiry", serial: 8, expectedErr: ErrorManifestExpiryMissing},
+		{name: "missing serial", expiresAt: &expiresAt, expectedErr: ErrorManifestSerialMissing},
+		{name: "legacy", legacy: true, expectedErr: ErrorManifestExpiryMissing},
+	} {
+		if test.legacy {
+			manifest, err = json.Marshal([]ServData{})
+		} else {
+			manifest, err = json.Marshal(ServManifest{SchemaVersion: ServManifestSchemaVersion, Serial: test.serial, GeneratedAt: time.Now(), ExpiresAt: test.expiresAt})
+		}
+		if err != nil {
+			t.Fatalf("manifest marshal err: %s", err)
+		}
+		_, srcStatus := source.SourceVersions(context.Background(), cfg)
+		if test.expectedErr == nil {
+			if srcStatus.Status == CheckFailure {
+				t.Errorf("%s: check err: %v", test.name, srcStatus.Errors)
+			}
+			continue
+		}
+		if srcStatus.Status != CheckFailure || !errors.Is(srcStatus.Errors[0], test.expectedErr) {
+			t.Errorf("%s: check err: expected %v, fact %v", test.name, test.expectedErr, srcStatus.Errors)
+		}
+	}
+	state, err := os.ReadFile(cfg.ManifestStateFile)
+	if err != nil || string(state) != fmt.Sprintf(`{"%s":7}`, source.UpdatesMapURL) {
+		t.Errorf("state file err: %v, %s", err, state)
+	}
+}
@@ -0,0 +1,144 @@
+package updaterini
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRetryPolicy is recommended RetryPolicy for unstable networks
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+var defaultRetryableStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+/*
+	RetryPolicy of http source requests. Network errors and responses with retryable status codes are retried.
+	Retry-After response header is used as delay, request is not retried if Retry-After is greater than MaxBackoff.
+	Asset downloads retry request only, response body read errors aren't retried (interrupted download is resumed by next load with UpdateConfig.CacheDir)
+*/
+type RetryPolicy struct {
+	MaxAttempts          int           // max requests count, request is not retried on 0 or 1
+	InitialBackoff       time.Duration // delay before second attempt, 1 second on 0
+	MaxBackoff           time.Duration // max delay between attempts, 30 seconds on 0
+	Multiplier           float64       // delay multiplier for every next attempt, 2 on 0
+	Jitter               float64       // random delay deviation (0 - 1), delay is backoff * (1 ± Jitter)
+	RetryableStatusCodes []int         // 408, 429, 500, 502, 503, 504 on nil
+}
+
+// RequestAttempt describes one http request attempt of source versions listing, asset downloads attempts aren't recorded
+type RequestAttempt struct {
+	URL        string
+	Attempt    int           // attempt number, starts from 1
+	StatusCode int           // response status code, 0 if response is not received
+	Err        error         // attempt error, nil on success
+	RetryDelay time.Duration // delay before next attempt, 0 if request is not retried
+}
+
+func (rp RetryPolicy) isStatusCodeRetryable(statusCode int) bool {
+	codes := rp.RetryableStatusCodes
+	if codes == nil {
+		codes = defaultRetryableStatusCodes
+	}
+	for _, code := range codes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func (rp RetryPolicy) getMaxBackoff() time.Duration {
+	if rp.MaxBackoff <= 0 {
+		return 30 * time.Second
+	}
+	return rp.MaxBackoff
+}
+
+func (rp RetryPolicy) getBackoff(attempt int) time.Duration {
+	initialBackoff := rp.InitialBackoff
+	if initialBackoff <= 0 {
+		initialBackoff = time.Second
+	}
+	multiplier := rp.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	backoff := float64(initialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if jitter := math.Min(math.Max(rp.Jitter, 0), 1); jitter > 0 {
+		backoff *= 1 - jitter + 2*jitter*rand.Float64()
+	}
+	if maxBackoff := float64(rp.getMaxBackoff()); backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+/*
+	get delay before next attempt. Return false if request shouldn't be retried
+*/
+func (rp RetryPolicy) getRetryDelay(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	if err == nil || attempt >= rp.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+	var rcErr *ResponseCodeError
+	if !errors.As(err, &rcErr) {
+		// network error
+		return rp.getBackoff(attempt), true
+	}
+	if !rp.isStatusCodeRetryable(rcErr.StatusCode) {
+		return 0, false
+	}
+	if retryAfter, ok := parseRetryAfter(rcErr.Header.Get("Retry-After")); ok {
+		if retryAfter > rp.getMaxBackoff() {
+			return 0, false
+		}
+		return retryAfter, true
+	}
+	return rp.getBackoff(attempt), true
+}
+
+// Retry-After: <seconds> or Retry-After: <http-date>
+func parseRetryAfter(retryAfter string) (time.Duration, bool) {
+	if retryAfter == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,99 @@
+package updaterini
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrorSignatureInvalid  = errors.New("error. signature is invalid")
+	ErrorSignatureNotFound = errors.New("error. signature not found")
+)
+
+const signatureFileExtension = ".sig"
+
+/*
+	parse detached ed25519 signature. Signature could be raw 64 bytes or base64 encoded text
+*/
+func parseSignature(signature []byte) ([]byte, error) {
+	if len(signature) == ed25519.SignatureSize {
+		return signature, nil
+	}
+	return decodeSignature(string(signature))
+}
+
+func decodeSignature(signature string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(decoded) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: can't parse signature", ErrorSignatureInvalid)
+	}
+	return decoded, nil
+}
+
+func (ac *ApplicationConfig) isSignatureRequired() bool {
+	return len(ac.TrustedPublicKeys) != 0
+}
+
+/*
+	Verify detached ed25519 signature (raw or base64 encoded) of message with any of TrustedPublicKeys.
+	Use it to verify custom UpdateSource manifests
+*/
+func (ac *ApplicationConfig) VerifySignature(message, signature []byte) error {
+	if len(signature) == 0 {
+		return ErrorSignatureNotFound
+	}
+	sig, err := parseSignature(signature)
+	if err != nil {
+		return err
+	}
+	for _, key := range ac.TrustedPublicKeys {
+		if len(key) == ed25519.PublicKeySize && ed25519.Verify(key, message, sig) {
+			return nil
+		}
+	}
+	return ErrorSignatureInvalid
+}
+
+func parseAssetSignature(version, filename, signature string) ([]byte, error) {
+	if signature == "" {
+		return nil, fmt.Errorf("%s: %w (%s)", version, ErrorSignatureNotFound, filename)
+	}
+	sig, err := decodeSignature(signature)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w (%s)", version, err, filename)
+	}
+	return sig, nil
+}
+
+// file content is held in memory during verification, so parallel loaded assets are verified one by one
+var verifyFileSignatureMu sync.Mutex
+
+/*
+	ed25519 signature can't be verified by content stream, whole file is read to memory
+*/
+func verifyFileSignature(cfg ApplicationConfig, filePath string, signature []byte) error {
+	verifyFileSignatureMu.Lock()
+	defer verifyFileSignatureMu.Unlock()
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	return cfg.VerifySignature(content, signature)
+}
+
+func getRequiredAssetSignature(ctx context.Context, cfg ApplicationConfig, ver Version, filename string) ([]byte, error) {
+	signature, err := ver.getAssetSignature(ctx, cfg, filename)
+	if err != nil {
+		return nil, err
+	}
+	if signature == nil {
+		return nil, fmt.Errorf("%w (%s)", ErrorSignatureNotFound, filename)
+	}
+	return signature, nil
+}
@@ -0,0 +1,216 @@
+package updaterini
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type testSignedServer struct {
+	manifestKey ed25519.PrivateKey
+	assetKey    ed25519.PrivateKey
+	asset       []byte // signed asset content
+	servedAsset []byte // served asset content
+}
+
+func (tss testSignedServer) start(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	expiresAt := time.Now().Add(time.Hour)
+	manifest, err := json.Marshal(ServManifest{
+		SchemaVersion: ServManifestSchemaVersion,
+		Serial:        1,
+		GeneratedAt:   time.Now(),
+		ExpiresAt:     &expiresAt,
+		Versions: []ServData{{
+			VersionFolderUrl: server.URL + "/1.0.1/",
+			Version:          "1.0.1",
+			Assets: []ServAsset{{
+				Filename:  "app_file",
+				Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(tss.assetKey, tss.asset)),
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("manifest marshal err: %s", err)
+	}
+	mux.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(manifest)
+	})
+	mux.HandleFunc("/manifest.json.sig", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(ed25519.Sign(tss.manifestKey, manifest))
+	})
+	mux.HandleFunc("/1.0.1/app_file", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(tss.servedAsset)
+	})
+	return server
+}
+
+func TestServerSourceSignatures(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key err: %s", err)
+	}
+	_, untrustedKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key err: %s", err)
+	}
+	content := []byte("1.0.1 content")
+	tests := []struct {
+		name        string
+		server      testSignedServer
+		checkErr    error
+		loadFileErr error
+	}{
+		{
+			name:   "valid signatures",
+			server: testSignedServer{manifestKey: privateKey, assetKey: privateKey, asset: content, servedAsset: content},
+		},
+		{
+			name:     "untrusted manifest signature",
+			server:   testSignedServer{manifestKey: untrustedKey, assetKey: privateKey, asset: content, servedAsset: content},
+			checkErr: ErrorSignatureInvalid,
+		},
+		{
+			name:        "untrusted asset signature",
+			server:      testSignedServer{manifestKey: privateKey, assetKey: untrustedKey, asset: content, servedAsset: content},
+			loadFileErr: ErrorSignatureInvalid,
+		},
+		{
+			name:        "tampered asset",
+			server:      testSignedServer{manifestKey: privateKey, assetKey: privateKey, asset: content, servedAsset: []byte("tampered")},
+			loadFileErr: ErrorSignatureInvalid,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := test.server.start(t)
+			defer server.Close()
+			cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+			if err != nil {
+				t.Fatalf("creating app config err: %s", err)
+			}
+			cfg.TrustedPublicKeys = []ed25519.PublicKey{publicKey}
+			uc := UpdateConfig{
+				ApplicationConfig: cfg,
+				Sources:           []UpdateSource{&UpdateSourceServer{UpdatesMapURL: server.URL + "/manifest.json"}},
+			}
+			ver, checkStatus := uc.CheckForUpdates()
+			if test.checkErr != nil {
+				if checkStatus.Status != CheckFailure || !errors.Is(checkStatus.SourcesStatuses[0].Errors[0], test.checkErr) {
+					t.Errorf("check err: expected %v, fact %v", test.checkErr, checkStatus.SourcesStatuses[0].Errors)
+				}
+				return
+			}
+			if ver == nil {
+				t.Fatalf("version not found: %v", checkStatus.SourcesStatuses[0].Errors)
+			}
+			tempDir, err := ioutil.TempDir("", "tss-*")
+			if err != nil {
+				t.Fatalf("create temp dir err %s", err)
+			}
+			defer func() {
+				err := os.RemoveAll(tempDir)
+				if err != nil {
+					t.Errorf("delete temp dir err %s", err)
+				}
+			}()
+			err = uc.LoadFilesToDir(ver, tempDir)
+			if (test.loadFileErr == nil && err != nil) || !errors.Is(err, test.loadFileErr) {
+				t.Errorf("load files err: expected %v, fact %v", test.loadFileErr, err)
+			}
+		})
+	}
+}
+
+func TestGitSourceSignatures(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key err: %s", err)
+	}
+	_, untrustedKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key err: %s", err)
+	}
+	content := []byte("1.0.1 content")
+	checksum := sha256.Sum256(content)
+	checksums := []byte(hex.EncodeToString(checksum[:]) + "  app_file\n")
+	tests := []struct {
+		name        string
+		checksumKey ed25519.PrivateKey
+		assets      string
+		checkErr    error
+	}{
+		{
+			name:        "valid signatures",
+			checksumKey: privateKey,
+			assets:      `{"name":"app_file","id":1},{"name":"app_file.sig","id":2},{"name":"checksums.txt","id":3},{"name":"checksums.txt.sig","id":4}`,
+		},
+		{
+			name:        "untrusted checksums signature",
+			checksumKey: untrustedKey,
+			assets:      `{"name":"app_file","id":1},{"name":"app_file.sig","id":2},{"name":"checksums.txt","id":3},{"name":"checksums.txt.sig","id":4}`,
+			checkErr:    ErrorSignatureInvalid,
+		},
+		{
+			name:        "missing asset signature",
+			checksumKey: privateKey,
+			assets:      `{"name":"app_file","id":1},{"name":"checksums.txt","id":3},{"name":"checksums.txt.sig","id":4}`,
+			checkErr:    ErrorSignatureNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := map[string][]byte{
+				"1": content,
+				"2": []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, content))),
+				"3": checksums,
+				"4": ed25519.Sign(test.checksumKey, checksums),
+			}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/user/repo/releases", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`[{"tag_name":"1.0.1","assets":[` + test.assets + `]}]`))
+			})
+			mux.HandleFunc("/repos/user/repo/releases/assets/", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write(files[path.Base(r.URL.Path)])
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+			if err != nil {
+				t.Fatalf("creating app config err: %s", err)
+			}
+			cfg.TrustedPublicKeys = []ed25519.PublicKey{publicKey}
+			source := UpdateSourceGitRepo{
+				UserName:          "user",
+				RepoName:          "repo",
+				APIBaseURL:        server.URL,
+				UploadsBaseURL:    server.URL,
+				ChecksumsFilename: "checksums.txt",
+			}
+			// signature errors are reported without ShowPrepareVersionErr
+			versions, srcStatus := source.SourceVersions(context.Background(), cfg)
+			if test.checkErr != nil {
+				if srcStatus.Status != CheckFailure || len(srcStatus.Errors) == 0 || !errors.Is(srcStatus.Errors[0], test.checkErr) {
+					t.Errorf("check err: expected %v, fact %v", test.checkErr, srcStatus.Errors)
+				}
+				return
+			}
+			if srcStatus.Status != CheckSuccess || len(versions) != 1 {
+				t.Errorf("check err: %v, %d versions", srcStatus.Errors, len(versions))
+			}
+		})
+	}
+}
@@ -1,25 +1,104 @@
 package updaterini
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 )
 
 var ErrorResponseCodeIsNotOK = errors.New("error. response code is not OK")
 
+// ResponseCodeError is returned on unexpected response status code, it matches ErrorResponseCodeIsNotOK with errors.Is
+type ResponseCodeError struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+}
+
+func (rcErr *ResponseCodeError) Error() string {
+	return fmt.Sprintf("%s: %d (%s)", ErrorResponseCodeIsNotOK, rcErr.StatusCode, rcErr.URL)
+}
+
+func (rcErr *ResponseCodeError) Is(target error) bool {
+	return target == ErrorResponseCodeIsNotOK
+}
+
+var ErrorRateLimitExceeded = errors.New("error. rate limit exceeded")
+
+// RateLimitError is returned if source API rate limit is exceeded, it matches ErrorRateLimitExceeded with errors.Is
+type RateLimitError struct {
+	Limit     int       // requests limit, -1 if unknown
+	Remaining int       // remaining requests, -1 if unknown
+	Reset     time.Time // limit reset time, zero if unknown
+	Err       *ResponseCodeError
+}
+
+func (rlErr *RateLimitError) Error() string {
+	if rlErr.Reset.IsZero() {
+		return fmt.Sprintf("%s (%s)", ErrorRateLimitExceeded, rlErr.Err.URL)
+	}
+	return fmt.Sprintf("%s, reset at %s (%s)", ErrorRateLimitExceeded, rlErr.Reset.Format(time.RFC3339), rlErr.Err.URL)
+}
+
+func (rlErr *RateLimitError) Is(target error) bool {
+	return target == ErrorRateLimitExceeded
+}
+
+func (rlErr *RateLimitError) Unwrap() error {
+	return rlErr.Err
+}
+
+/*
+	convert response code error with X-RateLimit-* or Retry-After headers to RateLimitError, return err as is otherwise
+*/
+func getRateLimitError(err error) error {
+	var rcErr *ResponseCodeError
+	if !errors.As(err, &rcErr) || (rcErr.StatusCode != http.StatusForbidden && rcErr.StatusCode != http.StatusTooManyRequests) {
+		return err
+	}
+	parseHeader := func(key string) int {
+		value, pErr := strconv.Atoi(rcErr.Header.Get(key))
+		if pErr != nil {
+			return -1
+		}
+		return value
+	}
+	rlErr := &RateLimitError{
+		Limit:     parseHeader("X-RateLimit-Limit"),
+		Remaining: parseHeader("X-RateLimit-Remaining"),
+		Err:       rcErr,
+	}
+	if reset := parseHeader("X-RateLimit-Reset"); reset >= 0 {
+		rlErr.Reset = time.Unix(int64(reset), 0)
+	}
+	if retryAfter, ok := parseRetryAfter(rcErr.Header.Get("Retry-After")); ok {
+		rlErr.Reset = time.Now().Add(retryAfter)
+	} else if rlErr.Remaining != 0 {
+		// 403 without exhausted limit is access error
+		return err
+	}
+	return rlErr
+}
+
 const (
 	SourceLabelGitRepo = "SourceGitRepo"
 	SourceLabelServer  = "SourceServer"
 )
 
+/*
+	UpdateSource is a source of versions. Implement it to use your own storage,
+	create versions with NewVersion and report errors with SourceStatus.AppendError
+*/
 type UpdateSource interface {
 	SourceLabel() string
-	getSourceVersions(cfg ApplicationConfig) ([]Version, SourceStatus)
+	SourceVersions(ctx context.Context, cfg ApplicationConfig) ([]Version, SourceStatus) // load all source versions, invalid versions should be skipped
 }
 
 type UpdateSourceGitRepo struct {
@@ -27,44 +106,65 @@ type UpdateSourceGitRepo struct {
 	RepoName            string
 	UseDraftVersions    bool   // on true releases marked as draft load and validate as others
 	PersonalAccessToken string // ONLY FOR DEBUG PURPOSE
+	ChecksumsFilename   string // release asset with sha256 checksums of other assets (sha256sum output format), on set releases without it are skipped
+	MaxReleases         int    // max count of newest releases to read, defaultGitMaxReleases on 0
+	APIBaseURL          string // GitHub API URL, defaultGitAPIBaseURL on empty. GitHub Enterprise: https://[hostname]/api/v3
+	UploadsBaseURL      string // release assets download API URL, APIBaseURL on empty
+	HTTP                HTTPConfig
+	releasesCache       *conditionalCache // releases pages cache, repeated checks with unchanged releases don't use API rate limit
 }
 
+const (
+	defaultGitAPIBaseURL  = "https://api.github.com"
+	defaultGitMaxReleases = 300
+	gitReleasesPerPage    = 100
+)
+
 func (sGit *UpdateSourceGitRepo) SourceLabel() string {
 	return SourceLabelGitRepo
 }
 
+func (sGit *UpdateSourceGitRepo) getAPIBaseUrl() string {
+	if sGit.APIBaseURL == "" {
+		return defaultGitAPIBaseURL
+	}
+	return strings.TrimRight(sGit.APIBaseURL, "/")
+}
+
+func (sGit *UpdateSourceGitRepo) getUploadsBaseUrl() string {
+	if sGit.UploadsBaseURL == "" {
+		return sGit.getAPIBaseUrl()
+	}
+	return strings.TrimRight(sGit.UploadsBaseURL, "/")
+}
+
 func (sGit *UpdateSourceGitRepo) getSourceUrl() string {
-	link := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases", sGit.UserName, sGit.RepoName)
+	link := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=%d", sGit.getAPIBaseUrl(), sGit.UserName, sGit.RepoName, gitReleasesPerPage)
 	return link
 }
 
+func (sGit *UpdateSourceGitRepo) getMaxReleases() int {
+	if sGit.MaxReleases <= 0 {
+		return defaultGitMaxReleases
+	}
+	return sGit.MaxReleases
+}
+
 func (sGit *UpdateSourceGitRepo) getLoadFileUrl(fileId int) string {
-	link := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/assets/%d", sGit.UserName, sGit.RepoName, fileId)
+	link := fmt.Sprintf("%s/repos/%s/%s/releases/assets/%d", sGit.getUploadsBaseUrl(), sGit.UserName, sGit.RepoName, fileId)
 	return link
 }
 
-func (sGit *UpdateSourceGitRepo) getSourceVersions(cfg ApplicationConfig) (resultVersions []Version, srcStatus SourceStatus) {
+func (sGit *UpdateSourceGitRepo) SourceVersions(ctx context.Context, cfg ApplicationConfig) (resultVersions []Version, srcStatus SourceStatus) {
 	srcStatus.Source = sGit
 	var customHeaders map[string]string
 	if sGit.PersonalAccessToken != "" {
 		customHeaders = make(map[string]string, 1)
 		customHeaders["Authorization"] = fmt.Sprintf("token %s", sGit.PersonalAccessToken)
 	}
-	resp, err := doGetRequest(sGit.getSourceUrl(), cfg, customHeaders, nil)
+	data, err := sGit.loadReleases(ctx, cfg, customHeaders, srcStatus.appendAttempt)
 	if err != nil {
-		srcStatus.appendError(err, true)
-		return nil, srcStatus
-	}
-	defer func() {
-		tmpErr := resp.Body.Close()
-		if tmpErr != nil {
-			srcStatus.appendError(tmpErr, false)
-		}
-	}()
-	var data []gitData
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	if err != nil {
-		srcStatus.appendError(err, true)
+		srcStatus.AppendError(err, true)
 		return nil, srcStatus
 	}
 	for _, gData := range data {
@@ -72,10 +172,15 @@ func (sGit *UpdateSourceGitRepo) getSourceVersions(cfg ApplicationConfig) (resul
 			continue
 		}
 		gVersion, err := newVersionGit(cfg, gData, *sGit)
+		if err == nil {
+			err = gVersion.assets.verifyChecksumsSignature(ctx, cfg, gVersion.loadAssetContent)
+		}
 		if err != nil {
-			if cfg.ShowPrepareVersionErr {
-				srcStatus.appendError(err, false)
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				srcStatus.AppendError(err, true)
+				return nil, srcStatus
 			}
+			srcStatus.appendPrepareVersionError(cfg, err)
 			continue
 		}
 		resultVersions = append(resultVersions, &gVersion)
@@ -83,53 +188,165 @@ func (sGit *UpdateSourceGitRepo) getSourceVersions(cfg ApplicationConfig) (resul
 	return resultVersions, srcStatus
 }
 
-func (sGit *UpdateSourceGitRepo) loadSourceFile(cfg ApplicationConfig, fileId int) (io.ReadCloser, error) {
-	customHeaders := make(map[string]string, 2)
+// load releases pages until last page or MaxReleases
+func (sGit *UpdateSourceGitRepo) loadReleases(ctx context.Context, cfg ApplicationConfig, customHeaders map[string]string, onAttempt func(RequestAttempt)) ([]gitData, error) {
+	maxReleases := sGit.getMaxReleases()
+	var data []gitData
+	err := loadListPages(ctx, cfg, sGit.HTTP, sGit.getSourceUrl(), customHeaders, getConditionalCache(&sGit.releasesCache, ""), maxReleases, onAttempt,
+		func(page []byte) (int, error) {
+			var pageData []gitData
+			err := json.Unmarshal(page, &pageData)
+			data = append(data, pageData...)
+			return len(pageData), err
+		})
+	if err != nil {
+		return nil, getRateLimitError(err)
+	}
+	if len(data) > maxReleases {
+		data = data[:maxReleases]
+	}
+	return data, nil
+}
+
+/*
+	load list pages following Link rel="next" header until last page or maxItems
+
+	appendPage - decodes page, returns page items count
+*/
+func loadListPages(ctx context.Context, cfg ApplicationConfig, httpConfig HTTPConfig, pageUrl string, customHeaders map[string]string,
+	cache *conditionalCache, maxItems int, onAttempt func(RequestAttempt), appendPage func(page []byte) (int, error)) error {
+	for itemsCount := 0; pageUrl != "" && itemsCount < maxItems; {
+		page, _, err := doConditionalGetRequest(ctx, pageUrl, cfg, httpConfig, customHeaders, cache, onAttempt)
+		if err != nil {
+			return err
+		}
+		pageItemsCount, err := appendPage(page.Body)
+		if err != nil {
+			return err
+		}
+		if pageItemsCount == 0 {
+			break
+		}
+		itemsCount += pageItemsCount
+		pageUrl = getNextPageUrl(page.Header.Get("Link"))
+	}
+	return nil
+}
+
+// Link: <url>; rel="prev", <url>; rel="next"
+func getNextPageUrl(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		segments := strings.Split(part, ";")
+		if len(segments) < 2 {
+			continue
+		}
+		pageUrl := strings.TrimSpace(segments[0])
+		if !strings.HasPrefix(pageUrl, "<") || !strings.HasSuffix(pageUrl, ">") {
+			continue
+		}
+		for _, param := range segments[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return pageUrl[1 : len(pageUrl)-1]
+			}
+		}
+	}
+	return ""
+}
+
+/*
+	offset - asset content first byte, source could ignore it and return full content
+*/
+func (sGit *UpdateSourceGitRepo) loadSourceFile(ctx context.Context, cfg ApplicationConfig, fileId int, offset int64) (io.ReadCloser, error) {
+	customHeaders := make(map[string]string, 3)
 	customHeaders["Accept"] = "application/octet-stream"
 	if sGit.PersonalAccessToken != "" {
 		customHeaders["Authorization"] = fmt.Sprintf("token %s", sGit.PersonalAccessToken)
 	}
-	resp, err := doGetRequest(sGit.getLoadFileUrl(fileId), cfg, customHeaders,
-		map[int]interface{}{200: struct{}{}, 302: struct{}{}})
+	setRangeHeader(customHeaders, offset)
+	resp, err := doGetRequest(ctx, sGit.getLoadFileUrl(fileId), cfg, sGit.HTTP, customHeaders,
+		map[int]interface{}{200: struct{}{}, 206: struct{}{}, 302: struct{}{}}, nil)
+	if err != nil {
+		return nil, getRateLimitError(err)
+	}
+	return getResponseBody(resp)
+}
+
+const maxSmallAssetSize = 1 << 20
+
+// read small asset content like checksums or signature file and close reader
+func readSmallAsset(reader io.ReadCloser) (_ []byte, err error) {
+	defer func() {
+		rCloseErr := reader.Close()
+		if err == nil {
+			err = rCloseErr
+		}
+	}()
+	return io.ReadAll(io.LimitReader(reader, maxSmallAssetSize))
+}
+
+// load small asset content like checksums or signature file
+func (sGit *UpdateSourceGitRepo) loadSourceFileContent(ctx context.Context, cfg ApplicationConfig, fileId int) ([]byte, error) {
+	reader, err := sGit.loadSourceFile(ctx, cfg, fileId, 0)
 	if err != nil {
 		return nil, err
 	}
-	return resp.Body, nil
+	return readSmallAsset(reader)
 }
 
 type UpdateSourceServer struct {
-	UpdatesMapURL string
+	UpdatesMapURL     string // updates map (ServManifest or legacy ServData array) url
+	SignatureURL      string // detached ed25519 signature of updates map, used if ApplicationConfig has trusted keys. UpdatesMapURL + ".sig" on empty
+	ManifestCacheFile string // file to persist updates map with its ETag/Last-Modified between application runs, updates map is cached in memory on empty
+	HTTP              HTTPConfig
+	manifestCache     *conditionalCache
+	manifest          *servManifest // last parsed updates map
+}
+
+// parsed updates map and its validators
+type servManifest struct {
+	etag         string
+	lastModified string
+	data         ServManifest
+	warnings     []error
+}
+
+func (sServ *UpdateSourceServer) getSignatureUrl() string {
+	if sServ.SignatureURL != "" {
+		return sServ.SignatureURL
+	}
+	return sServ.UpdatesMapURL + signatureFileExtension
 }
 
 func (sServ *UpdateSourceServer) SourceLabel() string {
 	return SourceLabelServer
 }
 
-func (sServ *UpdateSourceServer) getSourceVersions(cfg ApplicationConfig) (resultVersions []Version, srcStatus SourceStatus) {
+func (sServ *UpdateSourceServer) getSourceKey() string {
+	return sServ.UpdatesMapURL
+}
+
+func (sServ *UpdateSourceServer) SourceVersions(ctx context.Context, cfg ApplicationConfig) (resultVersions []Version, srcStatus SourceStatus) {
 	srcStatus.Source = sServ
-	resp, err := doGetRequest(sServ.UpdatesMapURL, cfg, nil, nil)
+	manifest, err := sServ.loadManifest(ctx, cfg, srcStatus.appendAttempt)
+	if err == nil {
+		// reused updates map could expire too
+		err = checkManifestFreshness(cfg, sServ.getSourceKey(), manifest.data, time.Now())
+	}
 	if err != nil {
-		srcStatus.appendError(err, true)
+		srcStatus.AppendError(err, true)
 		return nil, srcStatus
 	}
-	defer func() {
-		tmpErr := resp.Body.Close()
-		if tmpErr != nil {
-			srcStatus.appendError(tmpErr, false)
+	if cfg.ShowPrepareVersionErr {
+		for _, warning := range manifest.warnings {
+			srcStatus.AppendError(warning, false)
 		}
-	}()
-	var sData []ServData
-	err = json.NewDecoder(resp.Body).Decode(&sData)
-	if err != nil {
-		srcStatus.appendError(err, true)
-		return nil, srcStatus
 	}
-	for _, data := range sData {
-		version, err := newVersionServ(cfg, data, *sServ)
+	for _, data := range manifest.data.Versions {
+		// parsed updates map is reused, version shouldn't change it
+		data.Assets = append([]ServAsset(nil), data.Assets...)
+		version, err := newVersionServ(cfg, data, sServ)
 		if err != nil {
-			if cfg.ShowPrepareVersionErr {
-				srcStatus.appendError(err, false)
-			}
+			srcStatus.appendPrepareVersionError(cfg, err)
 			continue
 		}
 		resultVersions = append(resultVersions, &version)
@@ -137,38 +354,189 @@ func (sServ *UpdateSourceServer) getSourceVersions(cfg ApplicationConfig) (resul
 	return resultVersions, srcStatus
 }
 
-func (sServ *UpdateSourceServer) loadSourceFile(cfg ApplicationConfig, serverFolderUrl, filename string) (io.ReadCloser, error) {
-	resp, err := doGetRequest(serverFolderUrl+filename, cfg, nil, map[int]interface{}{200: struct{}{}})
+/*
+	load updates map with If-None-Match/If-Modified-Since headers. On 304 Not Modified previously parsed updates map is used,
+	its signature was verified on parsing
+*/
+func (sServ *UpdateSourceServer) loadManifest(ctx context.Context, cfg ApplicationConfig, onAttempt func(RequestAttempt)) (*servManifest, error) {
+	resp, notModified, err := doConditionalGetRequest(ctx, sServ.UpdatesMapURL, cfg, sServ.HTTP, nil,
+		getConditionalCache(&sServ.manifestCache, sServ.ManifestCacheFile), onAttempt)
+	if err != nil {
+		return nil, err
+	}
+	if manifest := sServ.manifest; notModified && manifest != nil && manifest.etag == resp.ETag && manifest.lastModified == resp.LastModified {
+		return manifest, nil
+	}
+	if cfg.isSignatureRequired() {
+		err = sServ.verifyManifestSignature(ctx, cfg, resp.Body, onAttempt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, warnings, err := ParseServManifest(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	sServ.manifest = &servManifest{
+		etag:         resp.ETag,
+		lastModified: resp.LastModified,
+		data:         data,
+		warnings:     warnings,
+	}
+	return sServ.manifest, nil
+}
+
+func (sServ *UpdateSourceServer) verifyManifestSignature(ctx context.Context, cfg ApplicationConfig, manifest []byte, onAttempt func(RequestAttempt)) (err error) {
+	resp, err := doGetRequest(ctx, sServ.getSignatureUrl(), cfg, sServ.HTTP, nil, nil, onAttempt)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrorSignatureNotFound, err)
+	}
+	defer func() {
+		tmpErr := resp.Body.Close()
+		if err == nil {
+			err = tmpErr
+		}
+	}()
+	signature, err := io.ReadAll(io.LimitReader(resp.Body, maxSmallAssetSize))
+	if err != nil {
+		return err
+	}
+	return cfg.VerifySignature(manifest, signature)
+}
+
+/*
+	offset - asset content first byte, source could ignore it and return full content
+*/
+func (sServ *UpdateSourceServer) loadSourceFile(ctx context.Context, cfg ApplicationConfig, serverFolderUrl, filename string, offset int64) (io.ReadCloser, error) {
+	customHeaders := make(map[string]string, 1)
+	setRangeHeader(customHeaders, offset)
+	resp, err := doGetRequest(ctx, serverFolderUrl+filename, cfg, sServ.HTTP, customHeaders, map[int]interface{}{200: struct{}{}, 206: struct{}{}}, nil)
 	if err != nil {
 		return nil, err
 	}
-	return resp.Body, nil
+	return getResponseBody(resp)
 }
 
+const defaultHTTPClientTimeout = 5 * time.Minute
+
 var reqHTTP = &http.Client{
-	Timeout: 5 * time.Minute,
+	Timeout: defaultHTTPClientTimeout,
 	Transport: &http.Transport{
 		TLSHandshakeTimeout:   5 * time.Second,
 		ResponseHeaderTimeout: 10 * time.Second,
 	},
 }
 
-func doGetRequest(url string, appConfig ApplicationConfig, customHeaders map[string]string, okCodes map[int]interface{}) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// HTTPConfig configures requests of http based source
+type HTTPConfig struct {
+	Client    *http.Client      // client for all source requests (proxy, custom CA, mTLS etc.), library client on nil
+	Transport http.RoundTripper // used with library client timeouts if Client is nil
+	Headers   map[string]string // added to every source request, source own headers (auth, accept) overrides it
+	UserAgent string            // overrides library User-Agent
+	Retry     RetryPolicy       // manifests and assets requests retry policy, requests are not retried by default. Assets body read errors are not retried
+}
+
+func (hc HTTPConfig) getClient() *http.Client {
+	if hc.Client != nil {
+		return hc.Client
+	}
+	if hc.Transport != nil {
+		return &http.Client{
+			Timeout:   defaultHTTPClientTimeout,
+			Transport: hc.Transport,
+		}
+	}
+	return reqHTTP
+}
+
+/*
+	do request with httpConfig retry policy
+
+	onAttempt - called after every attempt, could be nil. Asset downloads pass nil, attempts are recorded for versions listing only
+*/
+func doGetRequest(ctx context.Context, url string, appConfig ApplicationConfig, httpConfig HTTPConfig, customHeaders map[string]string, okCodes map[int]interface{}, onAttempt func(RequestAttempt)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := doGetRequestAttempt(ctx, url, appConfig, httpConfig, customHeaders, okCodes)
+		delay, retry := httpConfig.Retry.getRetryDelay(ctx, attempt, err)
+		if onAttempt != nil {
+			reqAttempt := RequestAttempt{URL: url, Attempt: attempt, Err: err}
+			var rcErr *ResponseCodeError
+			if resp != nil {
+				reqAttempt.StatusCode = resp.StatusCode
+			} else if errors.As(err, &rcErr) {
+				reqAttempt.StatusCode = rcErr.StatusCode
+			}
+			if retry {
+				reqAttempt.RetryDelay = delay
+			}
+			onAttempt(reqAttempt)
+		}
+		if !retry {
+			return resp, err
+		}
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return nil, err
+		}
+	}
+}
+
+func doGetRequestAttempt(ctx context.Context, url string, appConfig ApplicationConfig, httpConfig HTTPConfig, customHeaders map[string]string, okCodes map[int]interface{}) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", fmt.Sprintf(`updaterini %s (%s %s-%s)`, appConfig.currentVersion.version.String(), runtime.Version(), runtime.GOOS, runtime.GOARCH))
+	userAgent := httpConfig.UserAgent
+	if userAgent == "" {
+		userAgent = fmt.Sprintf(`updaterini %s (%s %s-%s)`, appConfig.currentVersion.version.String(), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	for key, header := range httpConfig.Headers {
+		req.Header.Set(key, header)
+	}
 	for key, customHeader := range customHeaders {
 		req.Header.Set(key, customHeader)
 	}
-	resp, err := reqHTTP.Do(req)
+	resp, err := httpConfig.getClient().Do(req)
 	if err != nil {
 		return nil, err
 	}
 	if _, ok := okCodes[resp.StatusCode]; (len(okCodes) != 0 || resp.StatusCode != 200) && !ok {
 		_ = resp.Body.Close()
-		return nil, ErrorResponseCodeIsNotOK
+		return nil, &ResponseCodeError{URL: url, StatusCode: resp.StatusCode, Header: resp.Header}
 	}
 	return resp, nil
 }
+
+func setRangeHeader(headers map[string]string, offset int64) {
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+}
+
+// response body with asset size and offset, if they are known
+/*
+	partial content without valid Content-Range is rejected, its offset is unknown.
+	Response body is closed on error
+*/
+func getResponseBody(resp *http.Response) (io.ReadCloser, error) {
+	body := assetReadCloser{ReadCloser: resp.Body, size: resp.ContentLength}
+	if resp.StatusCode == http.StatusPartialContent {
+		// Content-Range: bytes <first>-<last>/<size or *>
+		var last int64
+		var size string
+		contentRange := resp.Header.Get("Content-Range")
+		_, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &body.offset, &last, &size)
+		if err != nil || body.offset < 0 || last < body.offset {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("asset loading error: invalid Content-Range %q", contentRange)
+		}
+		body.size, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			body.size = UnknownAssetSize
+		}
+	}
+	if body.size < 0 {
+		body.size = UnknownAssetSize
+	}
+	return body, nil
+}
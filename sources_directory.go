@@ -0,0 +1,191 @@
+package updaterini
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const SourceLabelDirectory = "SourceDirectory"
+
+// sergen version folder layout defaults
+const (
+	DefaultDescriptionFilename      = "description.txt"
+	DefaultDescriptionNameSeparator = "====="
+)
+
+/*
+	UpdateSourceDirectory loads versions from local directory (USB drive, network share etc.)
+	with updaterini sergen layout: one folder per version, folder name is version tag.
+	Version folder contains version files and optional description file.
+	If ApplicationConfig has trusted keys, every version file has signature file near it (filename + ".sig")
+*/
+type UpdateSourceDirectory struct {
+	Dir                      string // versions directory
+	DescriptionFilename      string // version description file, it's not version file. DefaultDescriptionFilename on empty
+	DescriptionNameSeparator string // separates version name from version description in description file. DefaultDescriptionNameSeparator on empty
+}
+
+func (sDir *UpdateSourceDirectory) SourceLabel() string {
+	return SourceLabelDirectory
+}
+
+// local files are not cached
+func (sDir *UpdateSourceDirectory) getSourceKey() string {
+	return ""
+}
+
+func (sDir *UpdateSourceDirectory) getDescriptionFilename() string {
+	if sDir.DescriptionFilename == "" {
+		return DefaultDescriptionFilename
+	}
+	return sDir.DescriptionFilename
+}
+
+func (sDir *UpdateSourceDirectory) SourceVersions(ctx context.Context, cfg ApplicationConfig) (resultVersions []Version, srcStatus SourceStatus) {
+	srcStatus.Source = sDir
+	entries, err := os.ReadDir(sDir.Dir)
+	if err != nil {
+		srcStatus.AppendError(err, true)
+		return nil, srcStatus
+	}
+	for _, entry := range entries {
+		if err = ctx.Err(); err != nil {
+			srcStatus.AppendError(err, true)
+			return nil, srcStatus
+		}
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := sDir.readVersionDir(cfg, entry.Name())
+		if err != nil {
+			srcStatus.appendPrepareVersionError(cfg, err)
+			continue
+		}
+		version, err := newVersionServ(cfg, data, sDir)
+		if err != nil {
+			srcStatus.appendPrepareVersionError(cfg, err)
+			continue
+		}
+		resultVersions = append(resultVersions, &version)
+	}
+	return resultVersions, srcStatus
+}
+
+func (sDir *UpdateSourceDirectory) readVersionDir(cfg ApplicationConfig, versionDirName string) (ServData, error) {
+	data := ServData{
+		VersionFolderUrl: filepath.Join(sDir.Dir, versionDirName),
+		Version:          versionDirName,
+	}
+	entries, err := os.ReadDir(data.VersionFolderUrl)
+	if err != nil {
+		return ServData{}, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if entry.Name() == sDir.getDescriptionFilename() {
+			data.Name, data.Description, err = sDir.readDescriptionFile(filepath.Join(data.VersionFolderUrl, entry.Name()))
+			if err != nil {
+				return ServData{}, err
+			}
+			continue
+		}
+		if cfg.isSignatureRequired() && strings.HasSuffix(entry.Name(), signatureFileExtension) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return ServData{}, err
+		}
+		asset := ServAsset{
+			Filename: entry.Name(),
+			Size:     info.Size(),
+		}
+		if cfg.isSignatureRequired() && isVersionFilenameCorrect(asset.Filename, cfg.ValidateFilesNamesRegexes) {
+			asset.Signature, err = sDir.readSignatureFile(filepath.Join(data.VersionFolderUrl, asset.Filename+signatureFileExtension))
+			if err != nil {
+				return ServData{}, err
+			}
+		}
+		data.Assets = append(data.Assets, asset)
+	}
+	return data, nil
+}
+
+func (sDir *UpdateSourceDirectory) readDescriptionFile(path string) (name string, description string, _ error) {
+	desc, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	name, description = ParseVersionDescription(desc, sDir.DescriptionNameSeparator)
+	return name, description, nil
+}
+
+/*
+	ParseVersionDescription parses sergen version description file: <name><separator><description> or <description>.
+	It's shared by sources and sergen, so they read the same layout
+
+	separator - DefaultDescriptionNameSeparator on empty
+*/
+func ParseVersionDescription(desc []byte, separator string) (name string, description string) {
+	if separator == "" {
+		separator = DefaultDescriptionNameSeparator
+	}
+	if delimIndex := bytes.Index(desc, []byte(separator)); delimIndex != -1 {
+		return strings.TrimSpace(string(desc[:delimIndex])), strings.TrimSpace(string(desc[delimIndex+len(separator):]))
+	}
+	return "", strings.TrimSpace(string(desc))
+}
+
+// signature file content in base64, empty string if signature file doesn't exist
+func (sDir *UpdateSourceDirectory) readSignatureFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	content, err := readSmallAsset(file)
+	if err != nil {
+		return "", err
+	}
+	signature, err := parseSignature(content)
+	if err != nil {
+		return "", fmt.Errorf("%w (%s)", err, path)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+/*
+	offset - asset content first byte
+*/
+func (sDir *UpdateSourceDirectory) loadSourceFile(_ context.Context, _ ApplicationConfig, versionDir, filename string, offset int64) (_ io.ReadCloser, err error) {
+	file, err := os.Open(filepath.Join(versionDir, filename))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+		}
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		_, err = file.Seek(offset, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return assetReadCloser{ReadCloser: file, size: info.Size(), offset: offset}, nil
+}
@@ -0,0 +1,266 @@
+package updaterini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/blang/semver/v4"
+)
+
+const SourceLabelGitea = "SourceGitea"
+
+const giteaReleasesPerPage = 50
+
+// UpdateSourceGitea loads versions from Gitea or Forgejo repository releases
+type UpdateSourceGitea struct {
+	BaseURL               string // Gitea instance URL
+	Owner                 string
+	RepoName              string
+	Token                 string // access token. Sent only to BaseURL host
+	UseDraftVersions      bool   // on true releases marked as draft load and validate as others
+	UsePrereleaseVersions bool   // on true releases marked as prerelease load and validate as others
+	ChecksumsFilename     string // release asset with sha256 checksums of other assets (sha256sum output format), on set releases without it are skipped
+	MaxReleases           int    // max count of newest releases to read, defaultGitMaxReleases on 0
+	HTTP                  HTTPConfig
+	releasesCache         *conditionalCache // releases pages cache
+}
+
+func (sGitea *UpdateSourceGitea) SourceLabel() string {
+	return SourceLabelGitea
+}
+
+func (sGitea *UpdateSourceGitea) getBaseUrl() string {
+	return strings.TrimRight(sGitea.BaseURL, "/")
+}
+
+func (sGitea *UpdateSourceGitea) getSourceUrl() string {
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s/releases?limit=%d", sGitea.getBaseUrl(), url.PathEscape(sGitea.Owner), url.PathEscape(sGitea.RepoName), giteaReleasesPerPage)
+}
+
+func (sGitea *UpdateSourceGitea) getMaxReleases() int {
+	if sGitea.MaxReleases <= 0 {
+		return defaultGitMaxReleases
+	}
+	return sGitea.MaxReleases
+}
+
+// token is not sent to other hosts
+func (sGitea *UpdateSourceGitea) getHeaders(fileUrl string) map[string]string {
+	headers := make(map[string]string, 2)
+	if sGitea.Token != "" && strings.HasPrefix(fileUrl, sGitea.getBaseUrl()+"/") {
+		headers["Authorization"] = fmt.Sprintf("token %s", sGitea.Token)
+	}
+	return headers
+}
+
+func (sGitea *UpdateSourceGitea) SourceVersions(ctx context.Context, cfg ApplicationConfig) (resultVersions []Version, srcStatus SourceStatus) {
+	srcStatus.Source = sGitea
+	if sGitea.BaseURL == "" {
+		srcStatus.AppendError(errors.New(errorGiteaBaseUrlIsEmpty), true)
+		return nil, srcStatus
+	}
+	releases, err := sGitea.loadReleases(ctx, cfg, srcStatus.appendAttempt)
+	if err != nil {
+		srcStatus.AppendError(err, true)
+		return nil, srcStatus
+	}
+	for _, release := range releases {
+		if (release.Draft && !sGitea.UseDraftVersions) || (release.Prerelease && !sGitea.UsePrereleaseVersions) {
+			continue
+		}
+		version, err := newVersionGitea(cfg, release, *sGitea)
+		if err == nil {
+			err = version.assets.verifyChecksumsSignature(ctx, cfg, version.loadAssetContent)
+		}
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				srcStatus.AppendError(err, true)
+				return nil, srcStatus
+			}
+			srcStatus.appendPrepareVersionError(cfg, err)
+			continue
+		}
+		resultVersions = append(resultVersions, &version)
+	}
+	return resultVersions, srcStatus
+}
+
+func (sGitea *UpdateSourceGitea) loadReleases(ctx context.Context, cfg ApplicationConfig, onAttempt func(RequestAttempt)) ([]giteaRelease, error) {
+	releasesUrl := sGitea.getSourceUrl()
+	maxReleases := sGitea.getMaxReleases()
+	var releases []giteaRelease
+	err := loadListPages(ctx, cfg, sGitea.HTTP, releasesUrl, sGitea.getHeaders(releasesUrl), getConditionalCache(&sGitea.releasesCache, ""), maxReleases, onAttempt,
+		func(page []byte) (int, error) {
+			var pageReleases []giteaRelease
+			err := json.Unmarshal(page, &pageReleases)
+			releases = append(releases, pageReleases...)
+			return len(pageReleases), err
+		})
+	if err != nil {
+		return nil, getRateLimitError(err)
+	}
+	if len(releases) > maxReleases {
+		releases = releases[:maxReleases]
+	}
+	return releases, nil
+}
+
+/*
+	offset - asset content first byte, source could ignore it and return full content
+*/
+func (sGitea *UpdateSourceGitea) loadSourceFile(ctx context.Context, cfg ApplicationConfig, fileUrl string, offset int64) (io.ReadCloser, error) {
+	customHeaders := sGitea.getHeaders(fileUrl)
+	setRangeHeader(customHeaders, offset)
+	resp, err := doGetRequest(ctx, fileUrl, cfg, sGitea.HTTP, customHeaders, map[int]interface{}{200: struct{}{}, 206: struct{}{}}, nil)
+	if err != nil {
+		return nil, getRateLimitError(err)
+	}
+	return getResponseBody(resp)
+}
+
+const errorGiteaBaseUrlIsEmpty = "gitea base url is empty"
+
+type giteaRelease struct {
+	Prerelease  bool         `json:"prerelease"`
+	Draft       bool         `json:"draft"`
+	Name        string       `json:"name"`
+	ReleaseDate time.Time    `json:"published_at"`
+	Description string       `json:"body"`
+	Version     string       `json:"tag_name"`
+	Assets      []giteaAsset `json:"assets"`
+}
+
+type giteaAsset struct {
+	Id       int    `json:"id"`
+	Size     int64  `json:"size"`
+	UUID     string `json:"uuid"`
+	Filename string `json:"name"`
+	Url      string `json:"browser_download_url"`
+}
+
+type versionGitea struct {
+	versionDetails
+	data    giteaRelease
+	assets  releaseAssets
+	channel Channel
+	source  UpdateSourceGitea
+	version semver.Version
+}
+
+func newVersionGitea(cfg ApplicationConfig, data giteaRelease, src UpdateSourceGitea) (versionGitea, error) {
+	vGt := versionGitea{
+		data: data,
+	}
+	filenames := make([]string, len(data.Assets))
+	for i, asset := range data.Assets {
+		filenames[i] = asset.Filename
+	}
+	assets, err := newReleaseAssets(cfg, data.Version, filenames, src.ChecksumsFilename)
+	if err != nil {
+		return versionGitea{}, err
+	}
+	vGt.assets = assets
+	vGt.versionDetails, err = newVersionDetails(data.Version, data.ReleaseDate, false, "", nil)
+	if err != nil {
+		return versionGitea{}, err
+	}
+	for _, filename := range assets.getFilenames() {
+		asset, _ := vGt.findAsset(filename)
+		vGt.addAssetInfo(AssetInfo{Filename: filename, Size: asset.Size})
+	}
+
+	version, channel, err := parseVersion(cfg, data.Version)
+	if err != nil {
+		return versionGitea{}, err
+	}
+	vGt.version = version
+	vGt.channel = channel
+	vGt.source = src
+	return vGt, nil
+}
+
+func (vGt *versionGitea) VersionName() string {
+	return vGt.data.Name
+}
+
+func (vGt *versionGitea) VersionTag() string {
+	return vGt.data.Version
+}
+
+func (vGt *versionGitea) VersionDescription() string {
+	return vGt.data.Description
+}
+
+func (vGt *versionGitea) getVersion() semver.Version {
+	return vGt.version
+}
+
+func (vGt *versionGitea) getChannel() Channel {
+	return vGt.channel
+}
+
+func (vGt *versionGitea) getAssetsFilenames() []string {
+	return vGt.assets.getFilenames()
+}
+
+func (vGt *versionGitea) getCacheKey() string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", vGt.source.SourceLabel(), vGt.source.getBaseUrl(), vGt.source.Owner, vGt.source.RepoName, vGt.data.Version)
+}
+
+// find any release asset, including checksums and signatures files
+func (vGt *versionGitea) findAsset(filename string) (giteaAsset, bool) {
+	for _, asset := range vGt.data.Assets {
+		if asset.Filename == filename {
+			return asset, true
+		}
+	}
+	return giteaAsset{}, false
+}
+
+// attachment download url
+func (vGt *versionGitea) getAssetUrl(asset giteaAsset) string {
+	if asset.UUID != "" {
+		return fmt.Sprintf("%s/attachments/%s", vGt.source.getBaseUrl(), url.PathEscape(asset.UUID))
+	}
+	return asset.Url
+}
+
+func (vGt *versionGitea) getAssetSize(filename string) int64 {
+	if asset, ok := vGt.findAsset(filename); ok && vGt.assets.hasFile(filename) {
+		return asset.Size
+	}
+	return UnknownAssetSize
+}
+
+func (vGt *versionGitea) getAssetContentByFilename(ctx context.Context, cfg ApplicationConfig, filename string, offset int64) (io.ReadCloser, error) {
+	if asset, ok := vGt.findAsset(filename); ok && vGt.assets.hasFile(filename) {
+		return vGt.source.loadSourceFile(ctx, cfg, vGt.getAssetUrl(asset), offset)
+	}
+	return nil, errors.New(errorAssetNotFoundByFilename)
+}
+
+func (vGt *versionGitea) loadAssetContent(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error) {
+	asset, ok := vGt.findAsset(filename)
+	if !ok {
+		return nil, errors.New(errorAssetNotFoundByFilename)
+	}
+	reader, err := vGt.source.loadSourceFile(ctx, cfg, vGt.getAssetUrl(asset), 0)
+	if err != nil {
+		return nil, err
+	}
+	return readSmallAsset(reader)
+}
+
+func (vGt *versionGitea) getAssetChecksum(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error) {
+	return vGt.assets.getAssetChecksum(ctx, cfg, filename, vGt.loadAssetContent)
+}
+
+func (vGt *versionGitea) getAssetSignature(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error) {
+	return vGt.assets.getAssetSignature(ctx, cfg, filename, vGt.loadAssetContent)
+}
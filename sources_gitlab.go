@@ -0,0 +1,392 @@
+package updaterini
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/blang/semver/v4"
+)
+
+const SourceLabelGitLab = "SourceGitLab"
+
+const defaultGitLabBaseURL = "https://gitlab.com"
+
+/*
+	UpdateSourceGitLab loads versions from GitLab project releases. Version files are release links
+	or files of generic package with release tag version
+*/
+type UpdateSourceGitLab struct {
+	Project             string // project ID or path with namespace (group/project)
+	BaseURL             string // GitLab instance URL, defaultGitLabBaseURL on empty
+	Token               string // personal, group or project access token. Sent only to BaseURL host
+	PackageName         string // generic package name, on set version files are package files, release links are used otherwise
+	UseUpcomingVersions bool   // on true upcoming releases (released_at in future) load and validate as others
+	ChecksumsFilename   string // version file with sha256 checksums of other files (sha256sum output format), on set releases without it are skipped
+	MaxReleases         int    // max count of newest releases to read, defaultGitMaxReleases on 0
+	HTTP                HTTPConfig
+	releasesCache       *conditionalCache // releases and packages pages cache
+}
+
+func (sGitLab *UpdateSourceGitLab) SourceLabel() string {
+	return SourceLabelGitLab
+}
+
+func (sGitLab *UpdateSourceGitLab) getBaseUrl() string {
+	if sGitLab.BaseURL == "" {
+		return defaultGitLabBaseURL
+	}
+	return strings.TrimRight(sGitLab.BaseURL, "/")
+}
+
+func (sGitLab *UpdateSourceGitLab) getProjectUrl() string {
+	return fmt.Sprintf("%s/api/v4/projects/%s", sGitLab.getBaseUrl(), url.PathEscape(sGitLab.Project))
+}
+
+func (sGitLab *UpdateSourceGitLab) getMaxReleases() int {
+	if sGitLab.MaxReleases <= 0 {
+		return defaultGitMaxReleases
+	}
+	return sGitLab.MaxReleases
+}
+
+// token is not sent to release links of other hosts
+func (sGitLab *UpdateSourceGitLab) getHeaders(fileUrl string) map[string]string {
+	headers := make(map[string]string, 2)
+	if sGitLab.Token != "" && strings.HasPrefix(fileUrl, sGitLab.getBaseUrl()+"/") {
+		headers["PRIVATE-TOKEN"] = sGitLab.Token
+	}
+	return headers
+}
+
+func (sGitLab *UpdateSourceGitLab) SourceVersions(ctx context.Context, cfg ApplicationConfig) (resultVersions []Version, srcStatus SourceStatus) {
+	srcStatus.Source = sGitLab
+	releases, err := sGitLab.loadReleases(ctx, cfg, srcStatus.appendAttempt)
+	if err != nil {
+		srcStatus.AppendError(err, true)
+		return nil, srcStatus
+	}
+	var packages map[string]int
+	if sGitLab.PackageName != "" {
+		packages, err = sGitLab.loadPackages(ctx, cfg, srcStatus.appendAttempt)
+		if err != nil {
+			srcStatus.AppendError(err, true)
+			return nil, srcStatus
+		}
+	}
+	for _, release := range releases {
+		if release.Upcoming && !sGitLab.UseUpcomingVersions {
+			continue
+		}
+		if sGitLab.PackageName != "" {
+			// package files are loaded only for releases newer than current version
+			version, channel, err := parseVersion(cfg, release.Version)
+			if err != nil {
+				srcStatus.appendPrepareVersionError(cfg, err)
+				continue
+			}
+			if !isUpdateCandidate(cfg, version, channel) {
+				continue
+			}
+			err = sGitLab.setPackageFiles(ctx, cfg, &release, packages, srcStatus.appendAttempt)
+			if err != nil {
+				if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					srcStatus.AppendError(err, true)
+					return nil, srcStatus
+				}
+				srcStatus.appendPrepareVersionError(cfg, err)
+				continue
+			}
+		}
+		version, err := newVersionGitLab(cfg, release, *sGitLab)
+		if err == nil {
+			err = version.assets.verifyChecksumsSignature(ctx, cfg, version.loadAssetContent)
+		}
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				srcStatus.AppendError(err, true)
+				return nil, srcStatus
+			}
+			srcStatus.appendPrepareVersionError(cfg, err)
+			continue
+		}
+		resultVersions = append(resultVersions, &version)
+	}
+	return resultVersions, srcStatus
+}
+
+func (sGitLab *UpdateSourceGitLab) loadReleases(ctx context.Context, cfg ApplicationConfig, onAttempt func(RequestAttempt)) ([]gitLabRelease, error) {
+	releasesUrl := fmt.Sprintf("%s/releases?per_page=%d", sGitLab.getProjectUrl(), gitReleasesPerPage)
+	maxReleases := sGitLab.getMaxReleases()
+	var releases []gitLabRelease
+	err := loadListPages(ctx, cfg, sGitLab.HTTP, releasesUrl, sGitLab.getHeaders(releasesUrl), getConditionalCache(&sGitLab.releasesCache, ""), maxReleases, onAttempt,
+		func(page []byte) (int, error) {
+			var pageReleases []gitLabRelease
+			err := json.Unmarshal(page, &pageReleases)
+			releases = append(releases, pageReleases...)
+			return len(pageReleases), err
+		})
+	if err != nil {
+		return nil, getRateLimitError(err)
+	}
+	if len(releases) > maxReleases {
+		releases = releases[:maxReleases]
+	}
+	return releases, nil
+}
+
+// load generic packages with PackageName, return package version to package id map
+func (sGitLab *UpdateSourceGitLab) loadPackages(ctx context.Context, cfg ApplicationConfig, onAttempt func(RequestAttempt)) (map[string]int, error) {
+	packagesUrl := fmt.Sprintf("%s/packages?package_type=generic&package_name=%s&per_page=%d", sGitLab.getProjectUrl(), url.QueryEscape(sGitLab.PackageName), gitReleasesPerPage)
+	packages := make(map[string]int)
+	err := loadListPages(ctx, cfg, sGitLab.HTTP, packagesUrl, sGitLab.getHeaders(packagesUrl), getConditionalCache(&sGitLab.releasesCache, ""), maxListItems, onAttempt,
+		func(page []byte) (int, error) {
+			var pagePackages []gitLabPackage
+			err := json.Unmarshal(page, &pagePackages)
+			for _, pkg := range pagePackages {
+				// package_name filter matches names partially
+				if pkg.Name == sGitLab.PackageName {
+					packages[pkg.Version] = pkg.Id
+				}
+			}
+			return len(pagePackages), err
+		})
+	if err != nil {
+		return nil, getRateLimitError(err)
+	}
+	return packages, nil
+}
+
+// replace release links with files of release version package
+func (sGitLab *UpdateSourceGitLab) setPackageFiles(ctx context.Context, cfg ApplicationConfig, release *gitLabRelease, packages map[string]int, onAttempt func(RequestAttempt)) error {
+	release.Assets.Links = nil
+	packageVersion := release.Version
+	packageId, ok := packages[packageVersion]
+	if !ok {
+		packageVersion = strings.TrimLeft(packageVersion, "v")
+		packageId, ok = packages[packageVersion]
+	}
+	if !ok {
+		return fmt.Errorf("%s: %s (%s)", release.Version, errorGitLabPackageNotFound, sGitLab.PackageName)
+	}
+	filesUrl := fmt.Sprintf("%s/packages/%d/package_files?per_page=%d", sGitLab.getProjectUrl(), packageId, gitReleasesPerPage)
+	var files []gitLabPackageFile
+	err := loadListPages(ctx, cfg, sGitLab.HTTP, filesUrl, sGitLab.getHeaders(filesUrl), nil, maxListItems, onAttempt,
+		func(page []byte) (int, error) {
+			var pageFiles []gitLabPackageFile
+			err := json.Unmarshal(page, &pageFiles)
+			files = append(files, pageFiles...)
+			return len(pageFiles), err
+		})
+	if err != nil {
+		return getRateLimitError(err)
+	}
+	// file could be uploaded several times, the last upload is used
+	latestFiles := make(map[string]gitLabPackageFile, len(files))
+	for _, file := range files {
+		if latestFile, ok := latestFiles[file.Filename]; !ok || latestFile.Id < file.Id {
+			latestFiles[file.Filename] = file
+		}
+	}
+	for _, file := range files {
+		if latestFiles[file.Filename].Id != file.Id {
+			continue
+		}
+		release.Assets.Links = append(release.Assets.Links, gitLabLink{
+			Filename: file.Filename,
+			Url: fmt.Sprintf("%s/packages/generic/%s/%s/%s", sGitLab.getProjectUrl(), url.PathEscape(sGitLab.PackageName),
+				url.PathEscape(packageVersion), url.PathEscape(file.Filename)),
+			size:   file.Size,
+			sha256: file.SHA256,
+		})
+	}
+	return nil
+}
+
+/*
+	offset - asset content first byte, source could ignore it and return full content
+*/
+func (sGitLab *UpdateSourceGitLab) loadSourceFile(ctx context.Context, cfg ApplicationConfig, fileUrl string, offset int64) (io.ReadCloser, error) {
+	customHeaders := sGitLab.getHeaders(fileUrl)
+	setRangeHeader(customHeaders, offset)
+	resp, err := doGetRequest(ctx, fileUrl, cfg, sGitLab.HTTP, customHeaders, map[int]interface{}{200: struct{}{}, 206: struct{}{}}, nil)
+	if err != nil {
+		return nil, getRateLimitError(err)
+	}
+	return getResponseBody(resp)
+}
+
+const (
+	maxListItems = 10000
+
+	errorGitLabPackageNotFound = "generic package not found"
+)
+
+type gitLabRelease struct {
+	Name        string    `json:"name"`
+	Version     string    `json:"tag_name"`
+	Description string    `json:"description"`
+	ReleaseDate time.Time `json:"released_at"`
+	Upcoming    bool      `json:"upcoming_release"`
+	Assets      struct {
+		Links []gitLabLink `json:"links"`
+	} `json:"assets"`
+}
+
+type gitLabLink struct {
+	Filename       string `json:"name"`
+	Url            string `json:"url"`
+	DirectAssetUrl string `json:"direct_asset_url"`
+	size           int64  // known for package files only
+	sha256         string // known for package files only
+}
+
+func (link gitLabLink) getUrl() string {
+	if link.DirectAssetUrl != "" {
+		return link.DirectAssetUrl
+	}
+	return link.Url
+}
+
+type gitLabPackage struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type gitLabPackageFile struct {
+	Id       int    `json:"id"`
+	Filename string `json:"file_name"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"file_sha256"`
+}
+
+type versionGitLab struct {
+	versionDetails
+	data    gitLabRelease
+	assets  releaseAssets
+	channel Channel
+	source  UpdateSourceGitLab
+	version semver.Version
+}
+
+func newVersionGitLab(cfg ApplicationConfig, data gitLabRelease, src UpdateSourceGitLab) (versionGitLab, error) {
+	vGL := versionGitLab{
+		data: data,
+	}
+	filenames := make([]string, len(data.Assets.Links))
+	for i, link := range data.Assets.Links {
+		filenames[i] = link.Filename
+	}
+	assets, err := newReleaseAssets(cfg, data.Version, filenames, src.ChecksumsFilename)
+	if err != nil {
+		return versionGitLab{}, err
+	}
+	if src.ChecksumsFilename == "" {
+		for _, link := range data.Assets.Links {
+			if link.sha256 == "" || !assets.hasFile(link.Filename) {
+				continue
+			}
+			checksum, err := parseSHA256Checksum(link.sha256)
+			if err != nil {
+				return versionGitLab{}, fmt.Errorf("%s: %s (%s)", data.Version, err, link.Filename)
+			}
+			assets.setAssetChecksum(link.Filename, checksum)
+		}
+	}
+	vGL.assets = assets
+	vGL.versionDetails, err = newVersionDetails(data.Version, data.ReleaseDate, false, "", nil)
+	if err != nil {
+		return versionGitLab{}, err
+	}
+	for _, filename := range assets.getFilenames() {
+		link, _ := vGL.findLink(filename)
+		vGL.addAssetInfo(AssetInfo{Filename: filename, Size: link.size, SHA256: link.sha256})
+	}
+
+	version, channel, err := parseVersion(cfg, data.Version)
+	if err != nil {
+		return versionGitLab{}, err
+	}
+	vGL.version = version
+	vGL.channel = channel
+	vGL.source = src
+	return vGL, nil
+}
+
+func (vGL *versionGitLab) VersionName() string {
+	return vGL.data.Name
+}
+
+func (vGL *versionGitLab) VersionTag() string {
+	return vGL.data.Version
+}
+
+func (vGL *versionGitLab) VersionDescription() string {
+	return vGL.data.Description
+}
+
+func (vGL *versionGitLab) getVersion() semver.Version {
+	return vGL.version
+}
+
+func (vGL *versionGitLab) getChannel() Channel {
+	return vGL.channel
+}
+
+func (vGL *versionGitLab) getAssetsFilenames() []string {
+	return vGL.assets.getFilenames()
+}
+
+func (vGL *versionGitLab) getCacheKey() string {
+	return fmt.Sprintf("%s/%s/%s/%s", vGL.source.SourceLabel(), vGL.source.getBaseUrl(), vGL.source.Project, vGL.data.Version)
+}
+
+// find any release link, including checksums and signatures files
+func (vGL *versionGitLab) findLink(filename string) (gitLabLink, bool) {
+	for _, link := range vGL.data.Assets.Links {
+		if link.Filename == filename {
+			return link, true
+		}
+	}
+	return gitLabLink{}, false
+}
+
+func (vGL *versionGitLab) getAssetSize(filename string) int64 {
+	if link, ok := vGL.findLink(filename); ok && link.size > 0 && vGL.assets.hasFile(filename) {
+		return link.size
+	}
+	return UnknownAssetSize
+}
+
+func (vGL *versionGitLab) getAssetContentByFilename(ctx context.Context, cfg ApplicationConfig, filename string, offset int64) (io.ReadCloser, error) {
+	if link, ok := vGL.findLink(filename); ok && vGL.assets.hasFile(filename) {
+		return vGL.source.loadSourceFile(ctx, cfg, link.getUrl(), offset)
+	}
+	return nil, errors.New(errorAssetNotFoundByFilename)
+}
+
+func (vGL *versionGitLab) loadAssetContent(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error) {
+	link, ok := vGL.findLink(filename)
+	if !ok {
+		return nil, errors.New(errorAssetNotFoundByFilename)
+	}
+	reader, err := vGL.source.loadSourceFile(ctx, cfg, link.getUrl(), 0)
+	if err != nil {
+		return nil, err
+	}
+	return readSmallAsset(reader)
+}
+
+func (vGL *versionGitLab) getAssetChecksum(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error) {
+	return vGL.assets.getAssetChecksum(ctx, cfg, filename, vGL.loadAssetContent)
+}
+
+func (vGL *versionGitLab) getAssetSignature(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error) {
+	return vGL.assets.getAssetSignature(ctx, cfg, filename, vGL.loadAssetContent)
+}
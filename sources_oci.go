@@ -0,0 +1,399 @@
+package updaterini
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SourceLabelOCI = "SourceOCI"
+
+const (
+	ociMediaTypeImageManifest  = "application/vnd.oci.image.manifest.v1+json"
+	ociMediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	ociAnnotationTitle         = "org.opencontainers.image.title"
+	ociAnnotationDescription   = "org.opencontainers.image.description"
+	ociAnnotationCreated       = "org.opencontainers.image.created"
+	ociTagsPerPage             = 100
+
+	errorOCIUnsupportedManifest = "unsupported manifest media type"
+	errorOCIUnsupportedDigest   = "unsupported layer digest algorithm"
+	errorOCIAuthChallenge       = "unsupported registry auth challenge"
+	errorOCIInsecureRealm       = "registry auth realm is not https"
+)
+
+/*
+	UpdateSourceOCI loads versions from OCI registry repository (ORAS artifacts). Repository tags are version tags,
+	version files are artifact manifest layers with org.opencontainers.image.title annotation (filename).
+	Layers digests are used as files checksums. Manifests are loaded only for tags newer than current version
+*/
+type UpdateSourceOCI struct {
+	Registry   string // registry URL (https://ghcr.io)
+	Repository string // repository name (org/app)
+	Username   string // optional registry credentials, used for registry token requests or basic auth
+	Password   string
+	MaxTags    int // max count of tags to read, maxListItems on 0
+	HTTP       HTTPConfig
+	auth       *ociAuth // registry bearer token
+}
+
+// registry bearer token cache
+type ociAuth struct {
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+var ociAuthInitMu sync.Mutex
+
+func (sOCI *UpdateSourceOCI) getAuth() *ociAuth {
+	ociAuthInitMu.Lock()
+	defer ociAuthInitMu.Unlock()
+	if sOCI.auth == nil {
+		sOCI.auth = &ociAuth{}
+	}
+	return sOCI.auth
+}
+
+func (sOCI *UpdateSourceOCI) SourceLabel() string {
+	return SourceLabelOCI
+}
+
+func (sOCI *UpdateSourceOCI) getRegistryUrl() string {
+	return strings.TrimRight(sOCI.Registry, "/")
+}
+
+func (sOCI *UpdateSourceOCI) getRepositoryUrl() string {
+	return fmt.Sprintf("%s/v2/%s", sOCI.getRegistryUrl(), sOCI.Repository)
+}
+
+func (sOCI *UpdateSourceOCI) getMaxTags() int {
+	if sOCI.MaxTags <= 0 {
+		return maxListItems
+	}
+	return sOCI.MaxTags
+}
+
+func (sOCI *UpdateSourceOCI) SourceVersions(ctx context.Context, cfg ApplicationConfig) (resultVersions []Version, srcStatus SourceStatus) {
+	srcStatus.Source = sOCI
+	tags, err := sOCI.loadTags(ctx, cfg, srcStatus.appendAttempt)
+	if err != nil {
+		srcStatus.AppendError(err, true)
+		return nil, srcStatus
+	}
+	for _, tag := range tags {
+		version, channel, err := parseVersion(cfg, tag)
+		if err != nil {
+			srcStatus.appendPrepareVersionError(cfg, err)
+			continue
+		}
+		if !isUpdateCandidate(cfg, version, channel) {
+			continue
+		}
+		ociVersion, err := sOCI.newVersion(ctx, cfg, tag, srcStatus.appendAttempt)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				srcStatus.AppendError(err, true)
+				return nil, srcStatus
+			}
+			srcStatus.appendPrepareVersionError(cfg, err)
+			continue
+		}
+		resultVersions = append(resultVersions, ociVersion)
+	}
+	return resultVersions, srcStatus
+}
+
+type ociTagsList struct {
+	Tags []string `json:"tags"`
+}
+
+func (sOCI *UpdateSourceOCI) loadTags(ctx context.Context, cfg ApplicationConfig, onAttempt func(RequestAttempt)) ([]string, error) {
+	registryUrl, err := url.Parse(sOCI.getRegistryUrl())
+	if err != nil {
+		return nil, err
+	}
+	maxTags := sOCI.getMaxTags()
+	var tags []string
+	for pageUrl := fmt.Sprintf("%s/tags/list?n=%d", sOCI.getRepositoryUrl(), ociTagsPerPage); pageUrl != "" && len(tags) < maxTags; {
+		resp, err := sOCI.doRegistryRequest(ctx, cfg, pageUrl, nil, nil, onAttempt)
+		if err != nil {
+			return nil, err
+		}
+		var tagsList ociTagsList
+		err = json.NewDecoder(resp.Body).Decode(&tagsList)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(tagsList.Tags) == 0 {
+			break
+		}
+		tags = append(tags, tagsList.Tags...)
+		// Link: </v2/<name>/tags/list?n=<n>&last=<last>>; rel="next"
+		pageUrl = getNextPageUrl(resp.Header.Get("Link"))
+		if pageUrl != "" {
+			nextUrl, err := registryUrl.Parse(pageUrl)
+			if err != nil {
+				return nil, err
+			}
+			pageUrl = nextUrl.String()
+		}
+	}
+	if len(tags) > maxTags {
+		tags = tags[:maxTags]
+	}
+	return tags, nil
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type ociManifest struct {
+	MediaType   string            `json:"mediaType"`
+	Layers      []ociDescriptor   `json:"layers"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func (sOCI *UpdateSourceOCI) newVersion(ctx context.Context, cfg ApplicationConfig, tag string, onAttempt func(RequestAttempt)) (Version, error) {
+	resp, err := sOCI.doRegistryRequest(ctx, cfg, fmt.Sprintf("%s/manifests/%s", sOCI.getRepositoryUrl(), url.PathEscape(tag)),
+		map[string]string{"Accept": ociMediaTypeImageManifest + ", " + ociMediaTypeDockerManifest}, nil, onAttempt)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ociManifest
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxSmallAssetSize)).Decode(&manifest)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", tag, err)
+	}
+	mediaType := manifest.MediaType
+	if mediaType == "" {
+		mediaType = resp.Header.Get("Content-Type")
+	}
+	if mediaType != ociMediaTypeImageManifest && mediaType != ociMediaTypeDockerManifest {
+		return nil, fmt.Errorf("%s: %s (%s)", tag, errorOCIUnsupportedManifest, mediaType)
+	}
+
+	layers := make(map[string]ociDescriptor, len(manifest.Layers))
+	for _, layer := range manifest.Layers {
+		if filename := layer.Annotations[ociAnnotationTitle]; filename != "" {
+			layers[filename] = layer
+		}
+	}
+	info := VersionInfo{
+		Name:        manifest.Annotations[ociAnnotationTitle],
+		Description: manifest.Annotations[ociAnnotationDescription],
+		Tag:         tag,
+		SourceKey:   fmt.Sprintf("%s/%s", sOCI.SourceLabel(), sOCI.getRepositoryUrl()),
+		Metadata:    manifest.Annotations,
+	}
+	if created, ok := manifest.Annotations[ociAnnotationCreated]; ok {
+		// invalid date is ignored, it's optional
+		info.ReleaseDate, _ = time.Parse(time.RFC3339, created)
+	}
+	for _, layer := range manifest.Layers {
+		filename := layer.Annotations[ociAnnotationTitle]
+		if filename == "" || (cfg.isSignatureRequired() && strings.HasSuffix(filename, signatureFileExtension)) {
+			continue
+		}
+		if !strings.HasPrefix(layer.Digest, "sha256:") {
+			return nil, fmt.Errorf("%s: %s (%s)", tag, errorOCIUnsupportedDigest, layer.Digest)
+		}
+		asset := VersionAsset{
+			Filename:    filename,
+			Size:        layer.Size,
+			ContentType: layer.MediaType,
+			SHA256:      strings.TrimPrefix(layer.Digest, "sha256:"),
+		}
+		if sigLayer, ok := layers[filename+signatureFileExtension]; ok && cfg.isSignatureRequired() && isVersionFilenameCorrect(filename, cfg.ValidateFilesNamesRegexes) {
+			reader, err := sOCI.loadBlob(ctx, cfg, sigLayer.Digest, 0)
+			if err != nil {
+				return nil, err
+			}
+			content, err := readSmallAsset(reader)
+			if err != nil {
+				return nil, err
+			}
+			signature, err := parseSignature(content)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w (%s)", tag, err, filename+signatureFileExtension)
+			}
+			asset.Signature = base64.StdEncoding.EncodeToString(signature)
+		}
+		info.Assets = append(info.Assets, asset)
+	}
+	return newVersionCustom(cfg, info, func(ctx context.Context, cfg ApplicationConfig, filename string, offset int64) (io.ReadCloser, error) {
+		layer, ok := layers[filename]
+		if !ok {
+			return nil, errors.New(errorAssetNotFoundByFilename)
+		}
+		return sOCI.loadBlob(ctx, cfg, layer.Digest, offset)
+	})
+}
+
+/*
+	offset - blob content first byte, registry could ignore it and return full content
+*/
+func (sOCI *UpdateSourceOCI) loadBlob(ctx context.Context, cfg ApplicationConfig, digest string, offset int64) (io.ReadCloser, error) {
+	customHeaders := make(map[string]string, 2)
+	setRangeHeader(customHeaders, offset)
+	resp, err := sOCI.doRegistryRequest(ctx, cfg, fmt.Sprintf("%s/blobs/%s", sOCI.getRepositoryUrl(), digest), customHeaders,
+		map[int]interface{}{200: struct{}{}, 206: struct{}{}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return getResponseBody(resp)
+}
+
+/*
+	do registry request with registry auth. On 401 response auth challenge is solved and request is repeated
+*/
+func (sOCI *UpdateSourceOCI) doRegistryRequest(ctx context.Context, cfg ApplicationConfig, requestUrl string, customHeaders map[string]string,
+	okCodes map[int]interface{}, onAttempt func(RequestAttempt)) (*http.Response, error) {
+	headers := make(map[string]string, len(customHeaders)+1)
+	for key, header := range customHeaders {
+		headers[key] = header
+	}
+	auth := sOCI.getAuth()
+	if authorization := auth.getAuthorization(); authorization != "" {
+		headers["Authorization"] = authorization
+	}
+	resp, err := doGetRequest(ctx, requestUrl, cfg, sOCI.HTTP, headers, okCodes, onAttempt)
+	var rcErr *ResponseCodeError
+	if err == nil || !errors.As(err, &rcErr) || rcErr.StatusCode != http.StatusUnauthorized {
+		return resp, getRateLimitError(err)
+	}
+	authorization, err := sOCI.solveAuthChallenge(ctx, cfg, rcErr.Header.Get("WWW-Authenticate"), onAttempt)
+	if err != nil {
+		return nil, err
+	}
+	headers["Authorization"] = authorization
+	resp, err = doGetRequest(ctx, requestUrl, cfg, sOCI.HTTP, headers, okCodes, onAttempt)
+	return resp, getRateLimitError(err)
+}
+
+func (auth *ociAuth) getAuthorization() string {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	if auth.token == "" || (!auth.tokenExpiry.IsZero() && time.Now().After(auth.tokenExpiry)) {
+		return ""
+	}
+	return "Bearer " + auth.token
+}
+
+func (auth *ociAuth) setToken(token string, expiresIn int) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	auth.token = token
+	auth.tokenExpiry = time.Time{}
+	if expiresIn > 0 {
+		auth.tokenExpiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+}
+
+type ociTokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+/*
+	WWW-Authenticate: Bearer realm="<token url>",service="<service>",scope="<scope>" or Basic realm="<realm>"
+
+	return Authorization header value
+*/
+func (sOCI *UpdateSourceOCI) solveAuthChallenge(ctx context.Context, cfg ApplicationConfig, challenge string, onAttempt func(RequestAttempt)) (string, error) {
+	scheme, params := parseAuthChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if sOCI.Username == "" {
+			return "", fmt.Errorf("%s: %s", errorOCIAuthChallenge, challenge)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(sOCI.Username+":"+sOCI.Password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("%s: %s", errorOCIAuthChallenge, challenge)
+	}
+	tokenUrl, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("%s: %s", errorOCIAuthChallenge, challenge)
+	}
+	// credentials are sent to realm, plain http realm is allowed for plain http registry only
+	if tokenUrl.Scheme != "https" && (tokenUrl.Scheme != "http" || !strings.HasPrefix(strings.ToLower(sOCI.getRegistryUrl()), "http://")) {
+		return "", fmt.Errorf("%s: %s", errorOCIInsecureRealm, params["realm"])
+	}
+	query := tokenUrl.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	tokenUrl.RawQuery = query.Encode()
+	var headers map[string]string
+	if sOCI.Username != "" {
+		headers = map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(sOCI.Username+":"+sOCI.Password))}
+	}
+	resp, err := doGetRequest(ctx, tokenUrl.String(), cfg, sOCI.HTTP, headers, nil, onAttempt)
+	if err != nil {
+		return "", err
+	}
+	var tokenResp ociTokenResponse
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxSmallAssetSize)).Decode(&tokenResp)
+	_ = resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	token := tokenResp.Token
+	if token == "" {
+		token = tokenResp.AccessToken
+	}
+	sOCI.getAuth().setToken(token, tokenResp.ExpiresIn)
+	return "Bearer " + token, nil
+}
+
+// parse auth scheme and params of WWW-Authenticate header
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	challenge = strings.TrimSpace(challenge)
+	params := make(map[string]string)
+	spaceIndex := strings.Index(challenge, " ")
+	if spaceIndex == -1 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:spaceIndex], challenge[spaceIndex+1:]
+	for rest != "" {
+		eqIndex := strings.Index(rest, "=")
+		if eqIndex == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eqIndex]))
+		rest = strings.TrimSpace(rest[eqIndex+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			endIndex := strings.Index(rest[1:], `"`)
+			if endIndex == -1 {
+				break
+			}
+			value, rest = rest[1:endIndex+1], rest[endIndex+2:]
+		} else if commaIndex := strings.Index(rest, ","); commaIndex != -1 {
+			value, rest = rest[:commaIndex], rest[commaIndex:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = strings.TrimSpace(value)
+		rest = strings.TrimLeft(strings.TrimSpace(rest), ",")
+	}
+	return scheme, params
+}
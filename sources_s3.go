@@ -0,0 +1,410 @@
+package updaterini
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const SourceLabelS3 = "SourceS3"
+
+const (
+	defaultS3Region  = "us-east-1"
+	s3MaxListObjects = 100000
+)
+
+/*
+	UpdateSourceS3 loads versions from S3 compatible object storage (AWS S3, MinIO etc.).
+	Versions are read from manifest object (UpdateSourceServer format, folder_url is version objects key prefix)
+	or from version prefixes with updaterini sergen layout: <Prefix><version tag>/<version file>.
+	Versions older than current version are skipped in prefixes mode
+*/
+type UpdateSourceS3 struct {
+	Endpoint                 string // storage URL, https://s3.<Region>.amazonaws.com on empty
+	Region                   string // defaultS3Region on empty
+	Bucket                   string
+	UsePathStyle             bool   // on true bucket is URL path part (<Endpoint>/<Bucket>/<key>), bucket is Endpoint subdomain otherwise
+	Prefix                   string // versions key prefix ("releases/")
+	ManifestKey              string // manifest object key, on empty versions are read from Prefix folders
+	AccessKeyID              string // on empty requests are not signed (public bucket)
+	SecretAccessKey          string
+	SessionToken             string // optional temporary credentials token
+	DescriptionFilename      string // version description object name, it's not version file. DefaultDescriptionFilename on empty
+	DescriptionNameSeparator string // separates version name from version description in description file. DefaultDescriptionNameSeparator on empty
+	HTTP                     HTTPConfig
+}
+
+func (sS3 *UpdateSourceS3) SourceLabel() string {
+	return SourceLabelS3
+}
+
+func (sS3 *UpdateSourceS3) getRegion() string {
+	if sS3.Region == "" {
+		return defaultS3Region
+	}
+	return sS3.Region
+}
+
+func (sS3 *UpdateSourceS3) getEndpoint() string {
+	if sS3.Endpoint == "" {
+		return fmt.Sprintf("https://s3.%s.amazonaws.com", sS3.getRegion())
+	}
+	return strings.TrimRight(sS3.Endpoint, "/")
+}
+
+func (sS3 *UpdateSourceS3) getSourceKey() string {
+	if sS3.ManifestKey != "" {
+		return fmt.Sprintf("%s/%s/%s", sS3.getEndpoint(), sS3.Bucket, sS3.ManifestKey)
+	}
+	return fmt.Sprintf("%s/%s/%s", sS3.getEndpoint(), sS3.Bucket, sS3.Prefix)
+}
+
+// object url and signed request headers
+func (sS3 *UpdateSourceS3) getObjectRequest(key string, query url.Values, headers map[string]string) (string, map[string]string, error) {
+	endpoint, err := url.Parse(sS3.getEndpoint())
+	if err != nil {
+		return "", nil, err
+	}
+	host := endpoint.Host
+	path := strings.TrimRight(endpoint.EscapedPath(), "/") + "/"
+	if sS3.UsePathStyle {
+		path += s3UriEncode(sS3.Bucket, true) + "/"
+	} else {
+		host = sS3.Bucket + "." + host
+	}
+	path += s3UriEncode(key, false)
+	canonicalQuery := s3CanonicalQuery(query)
+	if headers == nil {
+		headers = make(map[string]string, 4)
+	}
+	if sS3.AccessKeyID != "" {
+		signS3Request(host, path, canonicalQuery, headers, sS3.AccessKeyID, sS3.SecretAccessKey, sS3.SessionToken, sS3.getRegion(), time.Now())
+	}
+	objectUrl := fmt.Sprintf("%s://%s%s", endpoint.Scheme, host, path)
+	if canonicalQuery != "" {
+		objectUrl += "?" + canonicalQuery
+	}
+	return objectUrl, headers, nil
+}
+
+func (sS3 *UpdateSourceS3) SourceVersions(ctx context.Context, cfg ApplicationConfig) (resultVersions []Version, srcStatus SourceStatus) {
+	srcStatus.Source = sS3
+	var sData []ServData
+	var err error
+	if sS3.ManifestKey != "" {
+		var manifest ServManifest
+		var warnings []error
+		manifest, warnings, err = sS3.loadManifest(ctx, cfg, srcStatus.appendAttempt)
+		if cfg.ShowPrepareVersionErr {
+			for _, warning := range warnings {
+				srcStatus.AppendError(warning, false)
+			}
+		}
+		sData = manifest.Versions
+	} else {
+		sData, err = sS3.loadPrefixes(ctx, cfg, &srcStatus)
+	}
+	if err != nil {
+		srcStatus.AppendError(err, true)
+		return nil, srcStatus
+	}
+	for _, data := range sData {
+		version, err := newVersionServ(cfg, data, sS3)
+		if err != nil {
+			srcStatus.appendPrepareVersionError(cfg, err)
+			continue
+		}
+		resultVersions = append(resultVersions, &version)
+	}
+	return resultVersions, srcStatus
+}
+
+func (sS3 *UpdateSourceS3) loadObjectContent(ctx context.Context, cfg ApplicationConfig, key string, onAttempt func(RequestAttempt)) ([]byte, error) {
+	objectUrl, headers, err := sS3.getObjectRequest(key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doGetRequest(ctx, objectUrl, cfg, sS3.HTTP, headers, nil, onAttempt)
+	if err != nil {
+		return nil, err
+	}
+	return readSmallAsset(resp.Body)
+}
+
+func (sS3 *UpdateSourceS3) loadManifest(ctx context.Context, cfg ApplicationConfig, onAttempt func(RequestAttempt)) (_ ServManifest, _ []error, err error) {
+	objectUrl, headers, err := sS3.getObjectRequest(sS3.ManifestKey, nil, nil)
+	if err != nil {
+		return ServManifest{}, nil, err
+	}
+	resp, err := doGetRequest(ctx, objectUrl, cfg, sS3.HTTP, headers, nil, onAttempt)
+	if err != nil {
+		return ServManifest{}, nil, err
+	}
+	defer func() {
+		tmpErr := resp.Body.Close()
+		if err == nil {
+			err = tmpErr
+		}
+	}()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ServManifest{}, nil, err
+	}
+	if cfg.isSignatureRequired() {
+		signature, err := sS3.loadObjectContent(ctx, cfg, sS3.ManifestKey+signatureFileExtension, onAttempt)
+		if err != nil {
+			return ServManifest{}, nil, fmt.Errorf("%w: %v", ErrorSignatureNotFound, err)
+		}
+		err = cfg.VerifySignature(content, signature)
+		if err != nil {
+			return ServManifest{}, nil, err
+		}
+	}
+	manifest, warnings, err := ParseServManifest(content)
+	if err != nil {
+		return ServManifest{}, nil, err
+	}
+	err = checkManifestFreshness(cfg, sS3.getSourceKey(), manifest, time.Now())
+	if err != nil {
+		return ServManifest{}, nil, err
+	}
+	return manifest, warnings, nil
+}
+
+type s3ListBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key string
+	}
+}
+
+// list objects with key prefix, ListObjectsV2
+func (sS3 *UpdateSourceS3) listObjects(ctx context.Context, cfg ApplicationConfig, prefix string, onAttempt func(RequestAttempt)) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": []string{"2"}, "prefix": []string{prefix}}
+	for len(keys) < s3MaxListObjects {
+		listUrl, headers, err := sS3.getObjectRequest("", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		page, _, err := doConditionalGetRequest(ctx, listUrl, cfg, sS3.HTTP, headers, nil, onAttempt)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListBucketResult
+		err = xml.Unmarshal(page.Body, &result)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	return keys, nil
+}
+
+// versions from <Prefix><version tag>/<version file> objects
+func (sS3 *UpdateSourceS3) loadPrefixes(ctx context.Context, cfg ApplicationConfig, srcStatus *SourceStatus) ([]ServData, error) {
+	keys, err := sS3.listObjects(ctx, cfg, sS3.Prefix, srcStatus.appendAttempt)
+	if err != nil {
+		return nil, err
+	}
+	descriptionFilename := DefaultDescriptionFilename
+	if sS3.DescriptionFilename != "" {
+		descriptionFilename = sS3.DescriptionFilename
+	}
+	var sData []ServData
+	versionsIndexes := make(map[string]int)
+	for _, key := range keys {
+		parts := strings.Split(strings.TrimPrefix(key, sS3.Prefix), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		versionTag, filename := parts[0], parts[1]
+		index, ok := versionsIndexes[versionTag]
+		if !ok {
+			// -1 for skipped versions
+			index = -1
+			version, channel, err := parseVersion(cfg, versionTag)
+			if err != nil {
+				srcStatus.appendPrepareVersionError(cfg, err)
+			}
+			if err == nil && isUpdateCandidate(cfg, version, channel) {
+				index = len(sData)
+				sData = append(sData, ServData{
+					VersionFolderUrl: sS3.Prefix + versionTag + "/",
+					Version:          versionTag,
+				})
+			}
+			versionsIndexes[versionTag] = index
+		}
+		if index == -1 {
+			continue
+		}
+		sData[index].Assets = append(sData[index].Assets, ServAsset{Filename: filename})
+	}
+	for i := range sData {
+		err = sS3.loadVersionMetadata(ctx, cfg, &sData[i], descriptionFilename, srcStatus.appendAttempt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sData, nil
+}
+
+// load version description and version files signatures
+func (sS3 *UpdateSourceS3) loadVersionMetadata(ctx context.Context, cfg ApplicationConfig, data *ServData, descriptionFilename string, onAttempt func(RequestAttempt)) error {
+	filenames := make(map[string]struct{}, len(data.Assets))
+	for _, asset := range data.Assets {
+		filenames[asset.Filename] = struct{}{}
+	}
+	assetsCounter := 0
+	for _, asset := range data.Assets {
+		if asset.Filename == descriptionFilename {
+			content, err := sS3.loadObjectContent(ctx, cfg, data.VersionFolderUrl+asset.Filename, onAttempt)
+			if err != nil {
+				return err
+			}
+			data.Name, data.Description = ParseVersionDescription(content, sS3.DescriptionNameSeparator)
+			continue
+		}
+		if cfg.isSignatureRequired() && strings.HasSuffix(asset.Filename, signatureFileExtension) {
+			continue
+		}
+		if _, ok := filenames[asset.Filename+signatureFileExtension]; ok && cfg.isSignatureRequired() && isVersionFilenameCorrect(asset.Filename, cfg.ValidateFilesNamesRegexes) {
+			content, err := sS3.loadObjectContent(ctx, cfg, data.VersionFolderUrl+asset.Filename+signatureFileExtension, onAttempt)
+			if err != nil {
+				return err
+			}
+			signature, err := parseSignature(content)
+			if err != nil {
+				return fmt.Errorf("%s: %w (%s)", data.Version, err, asset.Filename+signatureFileExtension)
+			}
+			asset.Signature = base64.StdEncoding.EncodeToString(signature)
+		}
+		data.Assets[assetsCounter] = asset
+		assetsCounter++
+	}
+	data.Assets = data.Assets[:assetsCounter]
+	return nil
+}
+
+/*
+	offset - asset content first byte, source could ignore it and return full content
+*/
+func (sS3 *UpdateSourceS3) loadSourceFile(ctx context.Context, cfg ApplicationConfig, keyPrefix, filename string, offset int64) (io.ReadCloser, error) {
+	customHeaders := make(map[string]string, 5)
+	setRangeHeader(customHeaders, offset)
+	objectUrl, headers, err := sS3.getObjectRequest(keyPrefix+filename, nil, customHeaders)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doGetRequest(ctx, objectUrl, cfg, sS3.HTTP, headers, map[int]interface{}{200: struct{}{}, 206: struct{}{}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return getResponseBody(resp)
+}
+
+const (
+	s3SignAlgorithm     = "AWS4-HMAC-SHA256"
+	s3EmptyPayloadHash  = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3SignTimeFormat    = "20060102T150405Z"
+	s3SignDateFormat    = "20060102"
+	s3SignServiceName   = "s3"
+	s3SignRequestSuffix = "aws4_request"
+)
+
+/*
+	sign GET request without body with AWS Signature Version 4. Signature and x-amz-* headers are added to headers,
+	all headers are signed
+
+	path - URI encoded path, canonicalQuery - sorted URI encoded query
+*/
+func signS3Request(host, path, canonicalQuery string, headers map[string]string, accessKeyID, secretAccessKey, sessionToken, region string, now time.Time) {
+	now = now.UTC()
+	headers["x-amz-date"] = now.Format(s3SignTimeFormat)
+	headers["x-amz-content-sha256"] = s3EmptyPayloadHash
+	if sessionToken != "" {
+		headers["x-amz-security-token"] = sessionToken
+	}
+
+	signHeaders := map[string]string{"host": host}
+	for key, value := range headers {
+		signHeaders[strings.ToLower(key)] = strings.TrimSpace(value)
+	}
+	headersNames := make([]string, 0, len(signHeaders))
+	for key := range signHeaders {
+		headersNames = append(headersNames, key)
+	}
+	sort.Strings(headersNames)
+	var canonicalHeaders strings.Builder
+	for _, key := range headersNames {
+		canonicalHeaders.WriteString(key + ":" + signHeaders[key] + "\n")
+	}
+	signedHeaders := strings.Join(headersNames, ";")
+
+	canonicalRequest := strings.Join([]string{"GET", path, canonicalQuery, canonicalHeaders.String(), signedHeaders, s3EmptyPayloadHash}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join([]string{now.Format(s3SignDateFormat), region, s3SignServiceName, s3SignRequestSuffix}, "/")
+	stringToSign := strings.Join([]string{s3SignAlgorithm, headers["x-amz-date"], scope, hex.EncodeToString(canonicalRequestHash[:])}, "\n")
+
+	signingKey := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{now.Format(s3SignDateFormat), region, s3SignServiceName, s3SignRequestSuffix} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	headers["Authorization"] = fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", s3SignAlgorithm, accessKeyID, scope, signedHeaders, signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// URI encode (RFC 3986 unreserved characters are not encoded), slash is not encoded if encodeSlash is false
+func s3UriEncode(value string, encodeSlash bool) string {
+	var result strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			result.WriteByte(b)
+			continue
+		}
+		result.WriteString(fmt.Sprintf("%%%02X", b))
+	}
+	return result.String()
+}
+
+// query sorted by keys, keys and values are URI encoded
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3UriEncode(key, true)+"="+s3UriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,128 @@
+package updaterini
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+const cachePartialFileExtension = ".part"
+const cacheDirPerm = 0755
+
+var cacheVersionDirRegex = regexp.MustCompile("^[0-9a-f]{32}$")
+
+/*
+	Delete all cached assets from CacheDir. Other CacheDir files are not deleted
+*/
+func (uc *UpdateConfig) ClearCache() error {
+	if uc.CacheDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(uc.CacheDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !cacheVersionDirRegex.MatchString(entry.Name()) {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(uc.CacheDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (vfl versionFilesLoader) getCachedAssetPath(cacheKey, filename string) string {
+	keyHash := sha256.Sum256([]byte(cacheKey))
+	return filepath.Join(vfl.updateConfig.CacheDir, hex.EncodeToString(keyHash[:16]), url.PathEscape(filename))
+}
+
+/*
+	load asset to cache dir, partially loaded asset is resumed. Return cached asset path
+*/
+func (vfl versionFilesLoader) loadAssetToCache(cacheKey, filename string) (string, error) {
+	if filename == "." || filename == ".." {
+		return "", fmt.Errorf("invalid asset filename: %s", filename)
+	}
+	cachedFilePath := vfl.getCachedAssetPath(cacheKey, filename)
+	if _, err := os.Stat(cachedFilePath); err == nil {
+		return cachedFilePath, nil
+	}
+	err := os.MkdirAll(filepath.Dir(cachedFilePath), cacheDirPerm)
+	if err != nil {
+		return "", err
+	}
+	partFilePath := cachedFilePath + cachePartialFileExtension
+	err = vfl.loadPartialAsset(filename, partFilePath)
+	if err != nil {
+		return "", err
+	}
+	return cachedFilePath, os.Rename(partFilePath, cachedFilePath)
+}
+
+func (vfl versionFilesLoader) loadPartialAsset(filename, partFilePath string) (err error) {
+	pFile, err := os.OpenFile(partFilePath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		pCloseErr := pFile.Close()
+		if err != nil && pCloseErr != nil {
+			err = fmt.Errorf("%v; close partial file error: %v", err, pCloseErr)
+		}
+		if err == nil {
+			err = pCloseErr
+		}
+	}()
+	offset, err := pFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset > 0 && offset == vfl.version.getAssetSize(filename) {
+		return nil
+	}
+
+	reader, readerOffset, err := vfl.openAsset(filename, offset)
+	if err != nil && offset > 0 {
+		// partial file could be broken, range is not satisfiable or its content range is invalid, load full asset
+		reader, readerOffset, err = vfl.openAsset(filename, 0)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		rCloseErr := reader.Close()
+		if err != nil && rCloseErr != nil {
+			err = fmt.Errorf("%v; close file source reader error: %v", err, rCloseErr)
+		}
+		if err == nil {
+			err = rCloseErr
+		}
+	}()
+	if readerOffset > offset {
+		return fmt.Errorf("asset loading error: unexpected content offset %d (%s)", readerOffset, filename)
+	}
+	if readerOffset < offset {
+		// source doesn't support offsets
+		err = pFile.Truncate(readerOffset)
+		if err != nil {
+			return err
+		}
+		_, err = pFile.Seek(readerOffset, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(pFile, ctxReader{ctx: vfl.ctx, reader: reader})
+	return err
+}
@@ -0,0 +1,192 @@
+package updaterini
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCachedAssetResume(t *testing.T) {
+	content := []byte(strings.Repeat("1.0.1 content ", 1000))
+	checksum := sha256.Sum256(content)
+	var assetRequests, rangeRequests int
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]ServData{{
+			VersionFolderUrl: server.URL + "/1.0.1/",
+			Version:          "1.0.1",
+			Assets:           []ServAsset{{Filename: "app_file", SHA256: hex.EncodeToString(checksum[:])}},
+		}})
+	})
+	mux.HandleFunc("/1.0.1/app_file", func(w http.ResponseWriter, r *http.Request) {
+		assetRequests++
+		if r.Header.Get("Range") != "" {
+			rangeRequests++
+		}
+		http.ServeContent(w, r, "app_file", time.Time{}, bytes.NewReader(content))
+	})
+
+	cacheDir, err := ioutil.TempDir("", "tcar-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(cacheDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	uc := UpdateConfig{
+		ApplicationConfig: cfg,
+		Sources:           []UpdateSource{&UpdateSourceServer{UpdatesMapURL: server.URL + "/manifest.json"}},
+		CacheDir:          cacheDir,
+	}
+	ver, checkStatus := uc.CheckForUpdates()
+	if ver == nil {
+		t.Fatalf("version not found: %v", checkStatus.SourcesStatuses[0].Errors)
+	}
+
+	// previous loading was interrupted
+	cachedFilePath := versionFilesLoader{updateConfig: &uc}.getCachedAssetPath(ver.getCacheKey(), "app_file")
+	err = os.MkdirAll(filepath.Dir(cachedFilePath), cacheDirPerm)
+	if err != nil {
+		t.Fatalf("create cache dir err: %s", err)
+	}
+	err = os.WriteFile(cachedFilePath+cachePartialFileExtension, content[:len(content)/2], 0644)
+	if err != nil {
+		t.Fatalf("write partial file err: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		destDir, err := ioutil.TempDir("", "tcar-*")
+		if err != nil {
+			t.Fatalf("create temp dir err %s", err)
+		}
+		err = uc.LoadFilesToDir(ver, destDir)
+		if err != nil {
+			t.Fatalf("load files err: %s", err)
+		}
+		fData, err := os.ReadFile(filepath.Join(destDir, "app_file"))
+		if err != nil {
+			t.Fatalf("file read err %s", err)
+		}
+		if !bytes.Equal(fData, content) {
+			t.Errorf("loaded file content is incorrect")
+		}
+		err = os.RemoveAll(destDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}
+	if assetRequests != 1 || rangeRequests != 1 {
+		t.Errorf("asset should be loaded once with range request, asset requests: %d, range requests: %d", assetRequests, rangeRequests)
+	}
+
+	err = uc.ClearCache()
+	if err != nil {
+		t.Fatalf("clear cache err: %s", err)
+	}
+	if _, err := os.Stat(cachedFilePath); !os.IsNotExist(err) {
+		t.Errorf("cached asset should be deleted")
+	}
+}
+
+func TestCachedAssetInvalidContentRange(t *testing.T) {
+	content := []byte(strings.Repeat("1.0.1 content ", 1000))
+	var assetRequests int
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]ServData{{
+			VersionFolderUrl: server.URL + "/1.0.1/",
+			Version:          "1.0.1",
+			Assets:           []ServAsset{{Filename: "app_file"}},
+		}})
+	})
+	mux.HandleFunc("/1.0.1/app_file", func(w http.ResponseWriter, r *http.Request) {
+		assetRequests++
+		if r.Header.Get("Range") != "" {
+			// partial content offset is unknown
+			w.Header().Set("Content-Range", "bytes */*")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[len(content)/2:])
+			return
+		}
+		_, _ = w.Write(content)
+	})
+
+	cacheDir, err := ioutil.TempDir("", "tcaicr-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(cacheDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	uc := UpdateConfig{
+		ApplicationConfig: cfg,
+		Sources:           []UpdateSource{&UpdateSourceServer{UpdatesMapURL: server.URL + "/manifest.json"}},
+		CacheDir:          cacheDir,
+	}
+	ver, checkStatus := uc.CheckForUpdates()
+	if ver == nil {
+		t.Fatalf("version not found: %v", checkStatus.SourcesStatuses[0].Errors)
+	}
+	cachedFilePath := versionFilesLoader{updateConfig: &uc}.getCachedAssetPath(ver.getCacheKey(), "app_file")
+	err = os.MkdirAll(filepath.Dir(cachedFilePath), cacheDirPerm)
+	if err != nil {
+		t.Fatalf("create cache dir err: %s", err)
+	}
+	err = os.WriteFile(cachedFilePath+cachePartialFileExtension, content[:len(content)/2], 0644)
+	if err != nil {
+		t.Fatalf("write partial file err: %s", err)
+	}
+
+	destDir, err := ioutil.TempDir("", "tcaicr-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(destDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	err = uc.LoadFilesToDir(ver, destDir)
+	if err != nil {
+		t.Fatalf("load files err: %s", err)
+	}
+	fData, err := os.ReadFile(filepath.Join(destDir, "app_file"))
+	if err != nil {
+		t.Fatalf("file read err %s", err)
+	}
+	if !bytes.Equal(fData, content) {
+		t.Errorf("loaded file content is incorrect")
+	}
+	if assetRequests != 2 {
+		t.Errorf("asset should be reloaded without range, asset requests: %d", assetRequests)
+	}
+}
@@ -0,0 +1,63 @@
+package updaterini
+
+import "io"
+
+const UnknownAssetSize = -1
+
+// UpdateProgress callbacks are called during update, any callback could be nil
+type UpdateProgress struct {
+	AssetStarted          func(filename string, size int64)         // asset loading started, size is UnknownAssetSize if source doesn't know it
+	AssetLoading          func(filename string, loaded, size int64) // asset bytes loaded, called on every received chunk
+	ArchiveEntryExtracted func(archiveFilename, entryName string)   // archive entry extracted to temp dir
+	FileReplaced          func(filePath string)                     // update file moved to application dir
+}
+
+func (up UpdateProgress) assetStarted(filename string, size int64) {
+	if up.AssetStarted != nil {
+		up.AssetStarted(filename, size)
+	}
+}
+
+func (up UpdateProgress) archiveEntryExtracted(archiveFilename, entryName string) {
+	if up.ArchiveEntryExtracted != nil {
+		up.ArchiveEntryExtracted(archiveFilename, entryName)
+	}
+}
+
+func (up UpdateProgress) fileReplaced(filePath string) {
+	if up.FileReplaced != nil {
+		up.FileReplaced(filePath)
+	}
+}
+
+// reports AssetLoading progress on read
+type progressReadCloser struct {
+	io.ReadCloser
+	progress UpdateProgress
+	filename string
+	loaded   int64
+	size     int64
+}
+
+func (pRC *progressReadCloser) Read(p []byte) (int, error) {
+	n, err := pRC.ReadCloser.Read(p)
+	if n > 0 && pRC.progress.AssetLoading != nil {
+		pRC.loaded += int64(n)
+		pRC.progress.AssetLoading(pRC.filename, pRC.loaded, pRC.size)
+	}
+	return n, err
+}
+
+// source response body with known asset size and first byte offset
+type assetReadCloser struct {
+	io.ReadCloser
+	size   int64
+	offset int64
+}
+
+func getReaderSizeAndOffset(reader io.Reader) (size int64, offset int64) {
+	if aRC, ok := reader.(assetReadCloser); ok {
+		return aRC.size, aRC.offset
+	}
+	return UnknownAssetSize, 0
+}
@@ -1,6 +1,7 @@
 package updaterini
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"regexp"
 	"runtime"
@@ -51,8 +52,10 @@ func newVersionCurrent(cfg ApplicationConfig, version string) (versionCurrent, e
 type ApplicationConfig struct {
 	currentVersion            versionCurrent
 	channels                  []Channel
-	ValidateFilesNamesRegexes []*regexp.Regexp // match with any regex file is valid
-	ShowPrepareVersionErr     bool             // on false block non-critical errors
+	ValidateFilesNamesRegexes []*regexp.Regexp    // match with any regex file is valid
+	ShowPrepareVersionErr     bool                // on false block non-critical errors, signature errors are critical and always reported
+	TrustedPublicKeys         []ed25519.PublicKey // on non-empty manifests and assets without valid signature of any key are rejected. Asset is read to memory for verification (ed25519 signs whole content), assets are verified one at a time
+	ManifestStateFile         string              // file to persist the highest serials of signed updates maps (rollback protection), serials are kept in memory on empty
 }
 
 /*
@@ -97,6 +100,18 @@ func (ac *ApplicationConfig) getReleaseChannel() *Channel {
 }
 
 type UpdateConfig struct {
-	ApplicationConfig ApplicationConfig
-	Sources           []UpdateSource // source oder is source PRIORITY
+	ApplicationConfig   ApplicationConfig
+	Sources             []UpdateSource // source oder is source PRIORITY
+	Progress            UpdateProgress // update progress callbacks, could be called concurrently if DownloadConcurrency > 1
+	CacheDir            string         // persistent assets cache dir, on set partially loaded assets are resumed and loaded assets are reused. Use ClearCache to delete cached assets
+	DownloadConcurrency int            // max count of assets loaded in parallel, assets are loaded one by one on 0
+	ArchiveLimits       ArchiveLimits  // archive assets extraction limits
+	// on true archive entries permissions (see ReplacementFile.Mode) and modification times are kept, symlinks and hardlinks are recreated.
+	// Symlinks targets should be relative and inside archive
+	PreserveArchiveAttributes bool
+	// on true assets without registered format extension are loaded before ReplacementFile getting and unpacked,
+	// if their content starts with registered format magic bytes (see RegisterAssetFormat). Compressed files are not unarchived then
+	DetectAssetsFormatsByContent bool
+	// absolute dirs, ReplacementFile.DestPath could be absolute path inside them
+	AllowedDestinationRoots []string
 }
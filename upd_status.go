@@ -1,5 +1,7 @@
 package updaterini
 
+import "errors"
+
 type CheckStatus int
 
 const (
@@ -9,12 +11,14 @@ const (
 )
 
 type SourceStatus struct {
-	Source UpdateSource // link to source instance, cast it to base class
-	Errors []error      // source errors
-	Status CheckStatus  // source status
+	Source   UpdateSource     // link to source instance, cast it to base class
+	Errors   []error          // source errors
+	Status   CheckStatus      // source status
+	Attempts []RequestAttempt // source versions listing requests attempts, asset downloads attempts aren't recorded
 }
 
-func (ss *SourceStatus) appendError(err error, critical bool) {
+// AppendError add error to source errors, critical error marks source check as failed
+func (ss *SourceStatus) AppendError(err error, critical bool) {
 	ss.Errors = append(ss.Errors, err)
 	if ss.Status == CheckFailure || critical {
 		ss.Status = CheckFailure
@@ -23,6 +27,24 @@ func (ss *SourceStatus) appendError(err error, critical bool) {
 	}
 }
 
+/*
+	add version preparing error. Signature errors are critical, so unsigned or tampered version doesn't disappear silently.
+	Other errors are non-critical, they are added on ApplicationConfig.ShowPrepareVersionErr only
+*/
+func (ss *SourceStatus) appendPrepareVersionError(cfg ApplicationConfig, err error) {
+	if errors.Is(err, ErrorSignatureNotFound) || errors.Is(err, ErrorSignatureInvalid) {
+		ss.AppendError(err, true)
+		return
+	}
+	if cfg.ShowPrepareVersionErr {
+		ss.AppendError(err, false)
+	}
+}
+
+func (ss *SourceStatus) appendAttempt(attempt RequestAttempt) {
+	ss.Attempts = append(ss.Attempts, attempt)
+}
+
 type SourceCheckStatus struct {
 	SourcesStatuses []SourceStatus // sources statuses
 	Status          CheckStatus    // sources check status
@@ -1,9 +1,8 @@
 package updaterini
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
@@ -12,9 +11,14 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
-var ErrorFailUpdateRollback = errors.New("error. update rollback failed")
+var (
+	ErrorFailUpdateRollback            = errors.New("error. update rollback failed")
+	ErrorReplacementDestinationInvalid = errors.New("error. replacement file destination is invalid")
+)
 
 const oldVersionReplacedFilesExtension = ".old"
 const versionReplacedAndRollbackExtensionDif = "est"
@@ -24,10 +28,17 @@ const oldVersionRollbackFilesExtension = oldVersionReplacedFilesExtension + vers
 	looking for new version in defined sources
 */
 func (uc *UpdateConfig) CheckAllSourcesForUpdates() (Version, SourceCheckStatus) {
+	return uc.CheckAllSourcesForUpdatesContext(context.Background())
+}
+
+/*
+	check CheckAllSourcesForUpdates documentation. ctx cancels sources requests
+*/
+func (uc *UpdateConfig) CheckAllSourcesForUpdatesContext(ctx context.Context) (Version, SourceCheckStatus) {
 	var versions []Version
 	var checkStatus SourceCheckStatus
 	for _, source := range uc.Sources {
-		sVersions, srcStatus := source.getSourceVersions(uc.ApplicationConfig)
+		sVersions, srcStatus := source.SourceVersions(ctx, uc.ApplicationConfig)
 		checkStatus.SourcesStatuses = append(checkStatus.SourcesStatuses, srcStatus)
 		if srcStatus.Status == CheckFailure {
 			continue
@@ -43,9 +54,16 @@ func (uc *UpdateConfig) CheckAllSourcesForUpdates() (Version, SourceCheckStatus)
 	looking for new version in defined sources. First source response with Ok code and any versions (even nil) will stop any other attempt to check other sources
 */
 func (uc *UpdateConfig) CheckForUpdates() (Version, SourceCheckStatus) {
+	return uc.CheckForUpdatesContext(context.Background())
+}
+
+/*
+	check CheckForUpdates documentation. ctx cancels sources requests
+*/
+func (uc *UpdateConfig) CheckForUpdatesContext(ctx context.Context) (Version, SourceCheckStatus) {
 	var checkStatus SourceCheckStatus
 	for _, source := range uc.Sources {
-		sVersion, srcStatus := source.getSourceVersions(uc.ApplicationConfig)
+		sVersion, srcStatus := source.SourceVersions(ctx, uc.ApplicationConfig)
 		checkStatus.SourcesStatuses = append(checkStatus.SourcesStatuses, srcStatus)
 		if srcStatus.Status == CheckFailure {
 			continue
@@ -66,6 +84,13 @@ func (uc *UpdateConfig) CheckForUpdates() (Version, SourceCheckStatus) {
 	Empty string dirPath for place file near to executable file
 */
 func (uc *UpdateConfig) LoadFilesToDir(ver Version, dirPath string) error {
+	return uc.LoadFilesToDirContext(context.Background(), ver, dirPath)
+}
+
+/*
+	check LoadFilesToDir documentation. ctx cancels files loading
+*/
+func (uc *UpdateConfig) LoadFilesToDirContext(ctx context.Context, ver Version, dirPath string) error {
 	if dirPath == "" {
 		exePath, err := os.Executable()
 		if err != nil {
@@ -74,11 +99,12 @@ func (uc *UpdateConfig) LoadFilesToDir(ver Version, dirPath string) error {
 		dirPath = filepath.Dir(exePath)
 	}
 	vfl := versionFilesLoader{
+		ctx:          ctx,
 		version:      ver,
 		updateConfig: uc,
-		getReplacementFileInfo: func(loadedFilename string) (ReplacementFile, error) {
+		getReplacementFileInfo: func(asset ReplacementAsset) (ReplacementFile, error) {
 			return ReplacementFile{
-				FileName:           loadedFilename,
+				FileName:           asset.Filename,
 				Mode:               ReplacementFileDefaultMode,
 				PreventFileLoading: false,
 			}, nil
@@ -94,17 +120,86 @@ func (uc *UpdateConfig) LoadFilesToDir(ver Version, dirPath string) error {
 const ReplacementFileInfoUseDefaultOrExistedFilePerm = 9999
 const ReplacementFileDefaultMode = fs.FileMode(0644)
 
+// mode of created replacement files dirs
+const replacementDirDefaultMode = fs.FileMode(0755)
+
 type ReplacementFile struct {
-	FileName           string
-	relFileDir         string      // rel path to dest dir
-	Mode               fs.FileMode // use ReplacementFileInfoUseDefaultOrExistedFilePerm to set default ReplacementFileDefaultMode or if file already exist, existed file permission
+	FileName string
+	// optional destination file path relative to app dir or absolute path inside one of UpdateConfig.AllowedDestinationRoots.
+	// On set FileName and archive entry dir are ignored
+	DestPath           string
+	fileDir            string      // dest dir, relative to app dir or absolute
+	Mode               fs.FileMode // use ReplacementFileInfoUseDefaultOrExistedFilePerm to set archive entry permission (UpdateConfig.PreserveArchiveAttributes), existed file permission or default ReplacementFileDefaultMode in this order
 	PreventFileLoading bool        // is file should be skipped during update
 }
 
+// replacement file path, relative dest dir is joined to appDir
+func (rf ReplacementFile) getFilePath(appDir string) string {
+	if filepath.IsAbs(rf.fileDir) {
+		return filepath.Join(rf.fileDir, rf.FileName)
+	}
+	return filepath.Join(appDir, rf.fileDir, rf.FileName)
+}
+
+/*
+	set dest dir and FileName by DestPath. Relative destination can't leave app dir,
+	absolute destination should be inside one of allowedRoots
+*/
+func (rf *ReplacementFile) applyDestPath(allowedRoots []string) error {
+	if rf.DestPath == "" {
+		return nil
+	}
+	destPath := filepath.Clean(rf.DestPath)
+	if filepath.IsAbs(destPath) {
+		if _, ok := getDestinationRoot(allowedRoots, filepath.Dir(destPath)); !ok {
+			return fmt.Errorf("%w: %s is outside of allowed roots", ErrorReplacementDestinationInvalid, rf.DestPath)
+		}
+	} else {
+		var err error
+		destPath, err = getArchiveEntryPath(rf.DestPath)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrorReplacementDestinationInvalid, rf.DestPath)
+		}
+	}
+	rf.fileDir = filepath.Dir(destPath)
+	rf.FileName = filepath.Base(destPath)
+	return nil
+}
+
+// allowed root, which absolute dir path is inside or equal to
+func getDestinationRoot(allowedRoots []string, absPath string) (string, bool) {
+	for _, root := range allowedRoots {
+		if !filepath.IsAbs(root) {
+			continue
+		}
+		relPath, err := filepath.Rel(root, absPath)
+		if err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return root, true
+		}
+	}
+	return "", false
+}
+
+/*
+	ReplacementAsset describes loaded file, which ReplacementFile is requested for.
+	File is version asset itself, its archive entry or its decompressed content
+*/
+type ReplacementAsset struct {
+	Asset       AssetInfo   // version asset
+	ArchivePath string      // slash separated entry path inside archive, empty if file isn't archive entry
+	Filename    string      // archive entry base name, decompressed file name or asset filename
+	Size        int64       // file size, UnknownAssetSize if it's unknown before loading or unpacking
+	Mode        fs.FileMode // archive entry type and permission, 0 if file isn't archive entry
+	LinkTarget  string      // symlink target, empty if file isn't symlink
+}
+
 type updateFile struct {
 	replacement ReplacementFile // file after replace
 
 	tmpFileName string
+	isSymlink   bool        // replacement is symlink
+	archiveMode fs.FileMode // archive entry permission, 0 if it's unknown or archive attributes are not preserved
+	modTime     time.Time   // archive entry modification time, zero if archive attributes are not preserved
 
 	curFileMode  fs.FileMode
 	curFileOwner int
@@ -121,12 +216,39 @@ type UpdateResult struct {
 }
 
 /*
-	Load Files -> Check hash -> doBeforeUpdate() ->
+	Check signatures -> Load Files -> Check hash and signatures -> doBeforeUpdate() ->
 	get file names from getReplacementFileInfo function, safe replace it if file exist in folder
 	(curAppDir or cur exec file folder on empty string).
-	Do rollback on any trouble
+	Do rollback on any trouble. Files replacing is journaled in app dir, call RecoverInterruptedUpdate on start
+	to finish update interrupted by process kill
 */
-func (uc *UpdateConfig) DoUpdate(ver Version, curAppDir string, getReplacementFileInfo func(loadedFilename string) (ReplacementFile, error), doBeforeUpdate func() error) (_ UpdateResult, err error) {
+func (uc *UpdateConfig) DoUpdate(ver Version, curAppDir string, getReplacementFileInfo func(loadedFilename string) (ReplacementFile, error), doBeforeUpdate func() error) (UpdateResult, error) {
+	return uc.DoUpdateContext(context.Background(), ver, curAppDir, getReplacementFileInfo, doBeforeUpdate)
+}
+
+/*
+	check DoUpdate documentation. ctx cancels files loading and files replacing,
+	on cancel during files replacing already replaced files are rolled back
+*/
+func (uc *UpdateConfig) DoUpdateContext(ctx context.Context, ver Version, curAppDir string, getReplacementFileInfo func(loadedFilename string) (ReplacementFile, error), doBeforeUpdate func() error) (UpdateResult, error) {
+	return uc.DoUpdateWithAssetsContext(ctx, ver, curAppDir, func(asset ReplacementAsset) (ReplacementFile, error) {
+		return getReplacementFileInfo(asset.Filename)
+	}, doBeforeUpdate)
+}
+
+/*
+	check DoUpdate documentation. getReplacementFileInfo gets loaded file description: version asset,
+	archive entry path, size and mode. ReplacementFile.DestPath could route file to any dir
+*/
+func (uc *UpdateConfig) DoUpdateWithAssets(ver Version, curAppDir string, getReplacementFileInfo func(asset ReplacementAsset) (ReplacementFile, error), doBeforeUpdate func() error) (UpdateResult, error) {
+	return uc.DoUpdateWithAssetsContext(context.Background(), ver, curAppDir, getReplacementFileInfo, doBeforeUpdate)
+}
+
+/*
+	check DoUpdateWithAssets documentation. ctx cancels files loading and files replacing,
+	on cancel during files replacing already replaced files are rolled back
+*/
+func (uc *UpdateConfig) DoUpdateWithAssetsContext(ctx context.Context, ver Version, curAppDir string, getReplacementFileInfo func(asset ReplacementAsset) (ReplacementFile, error), doBeforeUpdate func() error) (_ UpdateResult, err error) {
 	exePath, err := os.Executable()
 	if err != nil {
 		return UpdateResult{}, err
@@ -134,7 +256,10 @@ func (uc *UpdateConfig) DoUpdate(ver Version, curAppDir string, getReplacementFi
 	if curAppDir == "" {
 		curAppDir = filepath.Dir(exePath)
 	}
-	updateTempDir, err := os.MkdirTemp("", "update-*")
+	if _, err := os.Stat(filepath.Join(curAppDir, updateJournalFilename)); err == nil {
+		return UpdateResult{}, ErrorUpdateInterrupted
+	}
+	updateTempDir, err := newUpdateTempDir(curAppDir)
 	if err != nil {
 		return UpdateResult{}, err
 	}
@@ -148,9 +273,19 @@ func (uc *UpdateConfig) DoUpdate(ver Version, curAppDir string, getReplacementFi
 		}
 	}()
 
+	if uc.ApplicationConfig.isSignatureRequired() {
+		for _, filename := range ver.getAssetsFilenames() {
+			_, err = getRequiredAssetSignature(ctx, uc.ApplicationConfig, ver, filename)
+			if err != nil {
+				return UpdateResult{}, err
+			}
+		}
+	}
+
 	// load all files
 
 	vfl := versionFilesLoader{
+		ctx:                    ctx,
 		version:                ver,
 		updateConfig:           uc,
 		getReplacementFileInfo: getReplacementFileInfo,
@@ -166,86 +301,136 @@ func (uc *UpdateConfig) DoUpdate(ver Version, curAppDir string, getReplacementFi
 		return UpdateResult{}, err
 	}
 
+	err = ctx.Err()
+	if err != nil {
+		return UpdateResult{}, err
+	}
 	err = doBeforeUpdate()
 	if err != nil {
 		return UpdateResult{}, err
 	}
 
-	// replace files
+	// plan files replacing, replacing is journaled, so interrupted update could be recovered
 
-	rollbackUpdateOnErr := func(updateErr error) error {
-		if updateErr == nil {
-			return nil
-		}
-		rollbackErr := rollbackUpdatedFiles(curAppDir, updateFilesInfo, oldVersionReplacedFilesExtension, true)
-		if rollbackErr != nil {
-			return fmt.Errorf("rollback error: %v update error: %v", rollbackErr, updateErr)
+	journal := newUpdateJournal(curAppDir, updateTempDir)
+	replaceFilesInfo := make([]updateFile, 0, len(updateFilesInfo))
+	symlinks := make(map[string]struct{})
+	for _, uFile := range updateFilesInfo {
+		if uFile.isSymlink {
+			symlinks[uFile.replacement.getFilePath(curAppDir)] = struct{}{}
 		}
-		return updateErr
 	}
-
-	uniqRelPaths := make(map[string]struct{}, 0)
-	for i := range updateFilesInfo {
-		curDirPath := filepath.Join(curAppDir, updateFilesInfo[i].replacement.relFileDir)
-		if updateFilesInfo[i].replacement.relFileDir != "" && updateFilesInfo[i].replacement.relFileDir != "." {
-			if _, ok := uniqRelPaths[updateFilesInfo[i].replacement.relFileDir]; !ok {
-				err = os.MkdirAll(curDirPath, ReplacementFileDefaultMode)
-				err = rollbackUpdateOnErr(err)
+	uniqDirs := make(map[string]struct{}, 0)
+	for _, uFile := range updateFilesInfo {
+		err = ctx.Err()
+		if err != nil {
+			return UpdateResult{}, err
+		}
+		fileDir := uFile.replacement.fileDir
+		// absolute dest dir should stay inside its allowed root after symlinks resolving
+		rootDir := curAppDir
+		if filepath.IsAbs(fileDir) {
+			rootDir, _ = getDestinationRoot(uc.AllowedDestinationRoots, fileDir)
+		}
+		if fileDir != "" && fileDir != "." {
+			if _, ok := uniqDirs[fileDir]; !ok {
+				curDirPath := filepath.Join(curAppDir, fileDir)
+				if filepath.IsAbs(fileDir) {
+					curDirPath = fileDir
+				}
+				err = checkPathInsideDir(rootDir, curDirPath)
+				if err == nil {
+					err = os.MkdirAll(curDirPath, replacementDirDefaultMode)
+				}
 				if err != nil {
 					return UpdateResult{}, err
 				}
-				uniqRelPaths[updateFilesInfo[i].replacement.relFileDir] = struct{}{}
+				uniqDirs[fileDir] = struct{}{}
+			}
+		}
+		curFilepath := uFile.replacement.getFilePath(curAppDir)
+		if uFile.isSymlink {
+			// symlink target is resolved by the same rule, symlinks in dest dir can't redirect it outside
+			err = checkSymlinkTargetInsideDir(rootDir, curFilepath, uFile.tmpFileName, symlinks)
+			if err != nil {
+				return UpdateResult{}, err
 			}
 		}
-		curFilepath := filepath.Join(curDirPath, updateFilesInfo[i].replacement.FileName)
 		fInfo, err := os.Stat(curFilepath)
 
-		// rename old file is exist
+		// old file is renamed if it exists
 		if err == nil {
 			if fInfo.IsDir() {
 				continue
 			}
-			err = os.Rename(curFilepath, curFilepath+oldVersionReplacedFilesExtension)
-			err = rollbackUpdateOnErr(err)
-			if err != nil {
-				return UpdateResult{}, err
-			}
-			updateFilesInfo[i].curFileRenamed = true
-			updateFilesInfo[i].curFileMode = fInfo.Mode().Perm()
-			updateFilesInfo[i].fillFileOwnerInfo(fInfo)
+			uFile.curFileRenamed = true
+			uFile.curFileMode = fInfo.Mode().Perm()
+			uFile.fillFileOwnerInfo(fInfo)
 		}
-
-		// move new file to dir
-		err = os.Rename(updateFilesInfo[i].tmpFileName, curFilepath)
-		err = rollbackUpdateOnErr(err)
-		if err != nil {
-			return UpdateResult{}, err
-		}
-		fMode := updateFilesInfo[i].replacement.Mode
+		fMode := uFile.replacement.Mode
 		if fMode == ReplacementFileInfoUseDefaultOrExistedFilePerm {
-			if updateFilesInfo[i].curFileRenamed {
-				fMode = updateFilesInfo[i].curFileMode
+			if uFile.archiveMode != 0 {
+				fMode = uFile.archiveMode
+			} else if uFile.curFileRenamed {
+				fMode = uFile.curFileMode
 			} else {
 				fMode = ReplacementFileDefaultMode
 			}
 		}
-		err = os.Chmod(curFilepath, fMode)
-		err = rollbackUpdateOnErr(err)
+		journal.Files = append(journal.Files, updateJournalFile{
+			Path:       curFilepath,
+			TempPath:   uFile.tmpFileName,
+			IsSymlink:  uFile.isSymlink,
+			Mode:       fMode,
+			ModTime:    uFile.modTime,
+			HasCurrent: uFile.curFileRenamed,
+			Owner:      uFile.curFileOwner,
+			Group:      uFile.curFileGroup,
+		})
+		uFile.replacementMovedToDir = true
+		replaceFilesInfo = append(replaceFilesInfo, uFile)
+	}
+
+	// replace files
+
+	rollbackUpdateOnErr := func(updateErr error) error {
+		if updateErr == nil {
+			return nil
+		}
+		// journal is kept on rollback error, RecoverInterruptedUpdate could finish rollback
+		rollbackErr := journal.rollback()
+		if rollbackErr != nil {
+			return fmt.Errorf("rollback error: %v update error: %v", rollbackErr, updateErr)
+		}
+		return updateErr
+	}
+
+	err = journal.syncLoadedFiles()
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	err = rollbackUpdateOnErr(journal.save())
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	for i := range journal.Files {
+		err = rollbackUpdateOnErr(ctx.Err())
 		if err != nil {
 			return UpdateResult{}, err
 		}
-		if updateFilesInfo[i].curFileRenamed && (updateFilesInfo[i].curFileOwner != -1 || updateFilesInfo[i].curFileGroup != -1) {
-			err = os.Chown(curFilepath, updateFilesInfo[i].curFileOwner, updateFilesInfo[i].curFileGroup)
-			err = rollbackUpdateOnErr(err)
-		}
+		err = rollbackUpdateOnErr(journal.replaceFile(i))
 		if err != nil {
 			return UpdateResult{}, err
 		}
-		updateFilesInfo[i].replacementMovedToDir = true
+		uc.Progress.fileReplaced(journal.Files[i].Path)
+	}
+	err = rollbackUpdateOnErr(journal.remove())
+	if err != nil {
+		return UpdateResult{}, err
 	}
 
 	return UpdateResult{
-		updateFilesInfo: updateFilesInfo,
+		updateFilesInfo: replaceFilesInfo,
 		updateDir:       curAppDir,
 		curExeFilePath:  exePath,
 	}, err
@@ -284,7 +469,7 @@ func (uR *UpdateResult) DeletePreviousVersionFiles(mode DeleteMode, params ...in
 			if !file.curFileRenamed {
 				continue
 			}
-			curFilepath := filepath.Join(uR.updateDir, file.replacement.relFileDir, file.replacement.FileName)
+			curFilepath := file.replacement.getFilePath(uR.updateDir)
 			err := os.Remove(curFilepath + oldVersionReplacedFilesExtension)
 			if err != nil {
 				return err
@@ -480,9 +665,9 @@ func getUpdateResultByDirScan(dirPath string) (UpdateResult, error) {
 		if val.hasOldVer && val.hasNewVer {
 			updFileInfo = append(updFileInfo, updateFile{
 				replacement: ReplacementFile{
-					FileName:   filepath.Base(fName),
-					relFileDir: filepath.Dir(fName),
-					Mode:       ReplacementFileInfoUseDefaultOrExistedFilePerm,
+					FileName: filepath.Base(fName),
+					fileDir:  filepath.Dir(fName),
+					Mode:     ReplacementFileInfoUseDefaultOrExistedFilePerm,
 				},
 				tmpFileName:           "",
 				curFileMode:           val.oldVerFMode,
@@ -508,7 +693,7 @@ func rollbackUpdatedFiles(currentApplicationDir string, updateFiles []updateFile
 		if !file.curFileRenamed && !file.replacementMovedToDir {
 			continue
 		}
-		curFilepath := filepath.Join(currentApplicationDir, file.replacement.relFileDir, file.replacement.FileName)
+		curFilepath := file.replacement.getFilePath(currentApplicationDir)
 		if file.replacementMovedToDir {
 			err = os.Remove(curFilepath)
 			if err != nil {
@@ -525,62 +710,72 @@ func rollbackUpdatedFiles(currentApplicationDir string, updateFiles []updateFile
 	return nil
 }
 
-const ZipArchiveExtension = ".zip"
-
-var TarGzArchiveExtensions = []string{".tgz", ".tar.gz"}
-
 type versionFilesLoader struct {
+	ctx                    context.Context
 	version                Version
 	updateConfig           *UpdateConfig
-	getReplacementFileInfo func(loadedFilename string) (ReplacementFile, error)
+	getReplacementFileInfo func(asset ReplacementAsset) (ReplacementFile, error)
 	destDir                string
 	createOrdinaryFiles    bool // create temp files otherwise USE CAREFULLY files could replace each other in ordinary naming
 }
 
 func (vfl versionFilesLoader) loadVersionFiles() ([]updateFile, error) {
 	assetsFilenames := vfl.version.getAssetsFilenames()
-	archivesFilenames := make([]string, 0)
+	// packed assets replacement files info is known after unpacking. Assets format is known after loading,
+	// if it's detected by content
+	packedFilenames := make([]string, 0)
 	for i, filename := range assetsFilenames {
-		isArchive := false
-		for _, ext := range append(TarGzArchiveExtensions, ZipArchiveExtension) {
-			if strings.HasSuffix(filename, ext) {
-				isArchive = true
-				break
-			}
-		}
-		if isArchive {
-			archivesFilenames = append(archivesFilenames, filename)
+		if _, _, ok := getAssetFormatByFilename(filename); ok || vfl.updateConfig.DetectAssetsFormatsByContent {
+			packedFilenames = append(packedFilenames, filename)
 			continue
 		}
-		assetsFilenames[i-len(archivesFilenames)] = filename
+		assetsFilenames[i-len(packedFilenames)] = filename
 	}
-	assetsFilenames = assetsFilenames[:len(assetsFilenames)-len(archivesFilenames)]
+	assetsFilenames = assetsFilenames[:len(assetsFilenames)-len(packedFilenames)]
 
-	updateFilesInfo, err := vfl.loadUpdateFilesFromSource(assetsFilenames)
+	updateFilesInfo, loadFilenames, err := vfl.getAssetsReplacementFilesInfo(assetsFilenames)
 	if err != nil {
 		return nil, err
 	}
-	archivesUpdateFilesInfo, err := vfl.loadUpdateFilesFromSourceArchives(archivesFilenames)
+	tFileNames, err := vfl.loadUpdateFilesFromSourceParallel(append(loadFilenames, packedFilenames...))
 	if err != nil {
 		return nil, err
 	}
-	return append(updateFilesInfo, archivesUpdateFilesInfo...), nil
+	for i := range updateFilesInfo {
+		updateFilesInfo[i].tmpFileName = tFileNames[i]
+	}
+	packedUpdateFilesInfo, err := vfl.unpackAssets(packedFilenames, tFileNames[len(loadFilenames):])
+	if err != nil {
+		return nil, err
+	}
+	return append(updateFilesInfo, packedUpdateFilesInfo...), nil
 }
 
-func (vfl versionFilesLoader) loadUpdateFilesFromSourceArchives(archivesFilenames []string) ([]updateFile, error) {
+/*
+	unpack assets by their formats, assets of unknown format (format is detected by content) are used as is
+
+	assetsFPaths - loaded assets paths in assetsFilenames order
+*/
+func (vfl versionFilesLoader) unpackAssets(assetsFilenames []string, assetsFPaths []string) ([]updateFile, error) {
 	updateFilesInfo := make([]updateFile, 0)
-	for _, archive := range archivesFilenames {
-		fExt := filepath.Ext(archive)
-		fPath, err := vfl.loadUpdateFileFromSource(archive)
-		if err != nil {
-			return nil, err
+	for i, asset := range assetsFilenames {
+		format, unpackedFilename, ok := getAssetFormatByFilename(asset)
+		var err error
+		if !ok {
+			format, ok, err = getAssetFormatByContent(assetsFPaths[i])
+			if err != nil {
+				return nil, err
+			}
+			unpackedFilename = asset
 		}
 		var ufi []updateFile
-		if fExt == ZipArchiveExtension {
-			ufi, err = vfl.unpackZipArchive(fPath)
-
+		if ok {
+			ufi, err = vfl.unpackAsset(format, asset, unpackedFilename, assetsFPaths[i])
 		} else {
-			ufi, err = vfl.unpackTarGzArchive(fPath)
+			ufi, _, err = vfl.getAssetsReplacementFilesInfo([]string{asset})
+			if len(ufi) != 0 {
+				ufi[0].tmpFileName = assetsFPaths[i]
+			}
 		}
 		if err != nil {
 			return nil, err
@@ -590,154 +785,442 @@ func (vfl versionFilesLoader) loadUpdateFilesFromSourceArchives(archivesFilename
 	return updateFilesInfo, nil
 }
 
-func (vfl versionFilesLoader) unpackZipArchive(archiveFPath string) (updateFilesInfo []updateFile, err error) {
-	updateFilesInfo = make([]updateFile, 0)
-	zR, err := zip.OpenReader(archiveFPath)
+/*
+	decompress and unarchive asset
+
+	decompressedFilename - replacement filename of single compressed file (format without Unarchive)
+*/
+func (vfl versionFilesLoader) unpackAsset(format AssetFormat, assetFilename, decompressedFilename, assetFPath string) (updateFilesInfo []updateFile, err error) {
+	var replacementFileInfo ReplacementFile
+	if format.Unarchive == nil {
+		replacementFileInfo, err = vfl.getReplacementFile(ReplacementAsset{
+			Asset:    vfl.getAssetInfo(assetFilename),
+			Filename: decompressedFilename,
+			Size:     UnknownAssetSize,
+		}, "")
+		if err != nil || replacementFileInfo.PreventFileLoading {
+			return nil, err
+		}
+	}
+	limiter, err := newArchiveLimiter(vfl.updateConfig.ArchiveLimits, assetFilename, assetFPath)
+	if err != nil {
+		return nil, err
+	}
+	fR, err := os.Open(assetFPath)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
-		zRCloseErr := zR.Close()
-		if err != nil && zRCloseErr != nil {
-			err = fmt.Errorf("%v; zip close error: %v", err, zRCloseErr)
+		fRCloseErr := fR.Close()
+		if err != nil && fRCloseErr != nil {
+			err = fmt.Errorf("%v; %s file close error: %v", err, format.Name, fRCloseErr)
 		}
 		if err == nil {
-			err = zRCloseErr
+			err = fRCloseErr
 		}
 	}()
-
-	for _, file := range zR.File {
-		if file.FileInfo().IsDir() {
-			continue
-		}
-		fName := filepath.Base(file.Name)
-		replacementFileInfo, err := vfl.getReplacementFileInfo(fName)
+	var content io.Reader = fR
+	if format.Decompress != nil {
+		var dR io.ReadCloser
+		dR, err = format.Decompress(fR)
 		if err != nil {
 			return nil, err
 		}
-		if replacementFileInfo.PreventFileLoading {
-			continue
-		}
-		replacementFileInfo.relFileDir = filepath.Dir(file.Name)
+		defer func() {
+			dRCloseErr := dR.Close()
+			if err != nil && dRCloseErr != nil {
+				err = fmt.Errorf("%v; %s decompressor close error: %v", err, format.Name, dRCloseErr)
+			}
+			if err == nil {
+				err = dRCloseErr
+			}
+		}()
+		content = dR
+	}
 
-		zFReader, err := file.Open()
+	if format.Unarchive == nil {
+		err = limiter.addEntry(0)
 		if err != nil {
 			return nil, err
 		}
-		tFName, err := vfl.writeTempFileToDir(zFReader, fName)
+		var tFName string
+		tFName, err = vfl.writeTempFileToDir(limiter.reader(content), decompressedFilename, nil)
 		if err != nil {
 			return nil, err
 		}
-		updateFilesInfo = append(updateFilesInfo, updateFile{
+		vfl.updateConfig.Progress.archiveEntryExtracted(assetFilename, decompressedFilename)
+		return []updateFile{{
 			replacement:           replacementFileInfo,
 			tmpFileName:           tFName,
 			curFileRenamed:        false,
 			replacementMovedToDir: false,
-		})
+		}}, nil
 	}
 
-	return updateFilesInfo, nil
-}
-
-func (vfl versionFilesLoader) unpackTarGzArchive(archiveFPath string) (updateFilesInfo []updateFile, err error) {
-	updateFilesInfo = make([]updateFile, 0)
-	fR, err := os.Open(archiveFPath)
+	aR, err := format.Unarchive(content)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
-		fRCloseErr := fR.Close()
-		if err != nil && fRCloseErr != nil {
-			err = fmt.Errorf("%v; targz file close error: %v", err, fRCloseErr)
+		aRCloseErr := aR.Close()
+		if err != nil && aRCloseErr != nil {
+			err = fmt.Errorf("%v; %s archive close error: %v", err, format.Name, aRCloseErr)
 		}
 		if err == nil {
-			err = fRCloseErr
+			err = aRCloseErr
 		}
 	}()
-	gzR, err := gzip.NewReader(fR)
-	if err != nil {
-		return nil, err
-	}
-	defer func() {
-		gzRCloseErr := gzR.Close()
-		if err != nil && gzRCloseErr != nil {
-			err = fmt.Errorf("%v; targz archive close error: %v", err, gzRCloseErr)
-		}
-		if err == nil {
-			err = gzRCloseErr
-		}
-	}()
-	tR := tar.NewReader(gzR)
+	return vfl.unpackArchive(aR, limiter, assetFilename)
+}
 
+func (vfl versionFilesLoader) unpackArchive(aR ArchiveReader, limiter *archiveLimiter, archiveFilename string) ([]updateFile, error) {
+	updateFilesInfo := make([]updateFile, 0)
+	assetInfo := vfl.getAssetInfo(archiveFilename)
+	// extracted files temp paths by archive entry path, for hardlinks
+	extractedFiles := make(map[string]string)
+	// targets of extracted symlinks by archive entry path and entry paths of all archive symlinks
+	extractedSymlinks := make(map[string]string)
+	symlinks := make(map[string]struct{})
 	for {
-		hdr, err := tR.Next()
+		entry, err := aR.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return nil, err
 		}
-		if hdr.FileInfo().IsDir() {
+		if err := vfl.ctx.Err(); err != nil {
+			return nil, err
+		}
+		err = limiter.addEntry(entry.Size)
+		if err != nil {
+			return nil, err
+		}
+		entryPath, err := getArchiveEntryPath(entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		preserveAttributes := vfl.updateConfig.PreserveArchiveAttributes
+		isSymlink := entry.Mode&fs.ModeSymlink != 0
+		isHardlink := entry.IsHardlink
+		isRegular := entry.Mode.IsRegular() && !isHardlink
+		// links are recreated only if archive attributes are preserved, directories and other special files are skipped
+		if !isRegular && !((isSymlink || isHardlink) && preserveAttributes) {
 			continue
 		}
-		fName := filepath.Base(hdr.Name)
-		replacementFileInfo, err := vfl.getReplacementFileInfo(fName)
+		var linkedFile string
+		if isHardlink {
+			linkedPath, err := getArchiveEntryPath(entry.Linkname)
+			if err != nil {
+				return nil, err
+			}
+			// link target is not extracted (loading is prevented)
+			var ok bool
+			if linkedFile, ok = extractedFiles[linkedPath]; !ok {
+				continue
+			}
+		}
+		var linkTarget string
+		if isSymlink {
+			linkTarget = entry.Linkname
+			symlinks[entryPath] = struct{}{}
+		}
+		fName := filepath.Base(entryPath)
+		replacementFileInfo, err := vfl.getReplacementFile(ReplacementAsset{
+			Asset:       assetInfo,
+			ArchivePath: filepath.ToSlash(entryPath),
+			Filename:    fName,
+			Size:        entry.Size,
+			Mode:        entry.Mode,
+			LinkTarget:  linkTarget,
+		}, filepath.Dir(entryPath))
 		if err != nil {
 			return nil, err
 		}
 		if replacementFileInfo.PreventFileLoading {
 			continue
 		}
-		replacementFileInfo.relFileDir = filepath.Dir(hdr.Name)
 
-		tFName, err := vfl.writeTempFileToDir(tR, fName)
+		var tFName string
+		switch {
+		case isSymlink:
+			tFName, err = vfl.writeTempSymlinkToDir(entry.Linkname, fName)
+		case isHardlink:
+			// hardlink is extracted as linked file copy
+			var lFReader *os.File
+			lFReader, err = os.Open(linkedFile)
+			if err != nil {
+				return nil, err
+			}
+			tFName, err = vfl.writeTempFileToDir(limiter.reader(lFReader), fName, nil)
+			lFCloseErr := lFReader.Close()
+			if err == nil {
+				err = lFCloseErr
+			}
+		default:
+			tFName, err = vfl.writeTempFileToDir(limiter.reader(aR), fName, nil)
+		}
 		if err != nil {
 			return nil, err
 		}
-		updateFilesInfo = append(updateFilesInfo, updateFile{
+		if isSymlink {
+			extractedSymlinks[entryPath] = entry.Linkname
+		} else {
+			extractedFiles[entryPath] = tFName
+		}
+		vfl.updateConfig.Progress.archiveEntryExtracted(archiveFilename, entry.Name)
+		uFile := updateFile{
 			replacement:           replacementFileInfo,
 			tmpFileName:           tFName,
+			isSymlink:             isSymlink,
 			curFileRenamed:        false,
 			replacementMovedToDir: false,
-		})
+		}
+		if preserveAttributes {
+			uFile.modTime = entry.ModTime
+			if entry.HasPerm {
+				uFile.archiveMode = entry.Mode.Perm()
+			}
+		}
+		updateFilesInfo = append(updateFilesInfo, uFile)
+	}
+	// symlinks could be chained by any entries order
+	for entryPath, target := range extractedSymlinks {
+		err := checkArchiveSymlinkTarget(entryPath, target, symlinks)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return updateFilesInfo, nil
 }
 
 func (vfl versionFilesLoader) loadUpdateFilesFromSource(assetsFilenames []string) ([]updateFile, error) {
+	updateFilesInfo, loadFilenames, err := vfl.getAssetsReplacementFilesInfo(assetsFilenames)
+	if err != nil {
+		return nil, err
+	}
+	tFileNames, err := vfl.loadUpdateFilesFromSourceParallel(loadFilenames)
+	if err != nil {
+		return nil, err
+	}
+	for i := range updateFilesInfo {
+		updateFilesInfo[i].tmpFileName = tFileNames[i]
+	}
+	return updateFilesInfo, nil
+}
+
+/*
+	get replacement files info in assetsFilenames order. Return files info and filenames of assets, which should be loaded
+*/
+func (vfl versionFilesLoader) getAssetsReplacementFilesInfo(assetsFilenames []string) ([]updateFile, []string, error) {
 	updateFilesInfo := make([]updateFile, 0)
+	loadFilenames := make([]string, 0)
 	for _, filename := range assetsFilenames {
-		replacementFileInfo, err := vfl.getReplacementFileInfo(filename)
+		assetInfo := vfl.getAssetInfo(filename)
+		replacementFileInfo, err := vfl.getReplacementFile(ReplacementAsset{
+			Asset:    assetInfo,
+			Filename: filename,
+			Size:     assetInfo.Size,
+		}, "")
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if replacementFileInfo.PreventFileLoading {
 			continue
 		}
-		tFileName, err := vfl.loadUpdateFileFromSource(filename)
-		if err != nil {
-			return nil, err
-		}
+		loadFilenames = append(loadFilenames, filename)
 		updateFilesInfo = append(updateFilesInfo, updateFile{
 			replacement:           replacementFileInfo,
-			tmpFileName:           tFileName,
 			curFileRenamed:        false,
 			replacementMovedToDir: false,
 		})
 	}
-	return updateFilesInfo, nil
+	return updateFilesInfo, loadFilenames, nil
+}
+
+/*
+	get replacement file by callback, its dest dir is fileDir if ReplacementFile.DestPath is empty.
+	Symlink target is checked against replacement file path on update, so remapped symlink can't point outside
+	of app dir or its allowed root
+
+	fileDir - dir relative to app dir, archive entry dir
+*/
+func (vfl versionFilesLoader) getReplacementFile(asset ReplacementAsset, fileDir string) (ReplacementFile, error) {
+	replacementFileInfo, err := vfl.getReplacementFileInfo(asset)
+	if err != nil || replacementFileInfo.PreventFileLoading {
+		return replacementFileInfo, err
+	}
+	replacementFileInfo.fileDir = fileDir
+	return replacementFileInfo, replacementFileInfo.applyDestPath(vfl.updateConfig.AllowedDestinationRoots)
+}
+
+// version asset info, only filename is known if version doesn't describe asset
+func (vfl versionFilesLoader) getAssetInfo(filename string) AssetInfo {
+	for _, info := range vfl.version.VersionAssets() {
+		if info.Filename == filename {
+			return info
+		}
+	}
+	return AssetInfo{Filename: filename, Size: UnknownAssetSize}
+}
+
+/*
+	load assets with UpdateConfig.DownloadConcurrency workers, first error cancels other loadings.
+	Return loaded files paths in assetsFilenames order
+*/
+func (vfl versionFilesLoader) loadUpdateFilesFromSourceParallel(assetsFilenames []string) ([]string, error) {
+	// checksums and signatures are loaded before workers start, because versions cache them
+	checksums := make([][]byte, len(assetsFilenames))
+	signatures := make([][]byte, len(assetsFilenames))
+	for i, filename := range assetsFilenames {
+		var err error
+		checksums[i], signatures[i], err = vfl.getAssetVerificationData(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(vfl.ctx)
+	defer cancel()
+	workerVfl := vfl
+	workerVfl.ctx = ctx
+	workersCount := vfl.updateConfig.DownloadConcurrency
+	if workersCount < 1 {
+		workersCount = 1
+	}
+	if workersCount > len(assetsFilenames) {
+		workersCount = len(assetsFilenames)
+	}
+
+	tFileNames := make([]string, len(assetsFilenames))
+	errs := make([]error, len(assetsFilenames))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workersCount; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				tFileNames[i], errs[i] = workerVfl.loadUpdateFileFromSource(assetsFilenames[i], checksums[i], signatures[i])
+				if errs[i] != nil {
+					cancel()
+				}
+			}
+		}()
+	}
+jobsLoop:
+	for i := range assetsFilenames {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break jobsLoop
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// return original error, not cancellation caused by it
+	var firstErr error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+	}
+	if firstErr == nil {
+		firstErr = vfl.ctx.Err()
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return tFileNames, nil
 }
 
-func (vfl versionFilesLoader) loadUpdateFileFromSource(filename string) (string, error) {
-	reader, err := vfl.version.getAssetContentByFilename(vfl.updateConfig.ApplicationConfig, filename)
+func (vfl versionFilesLoader) getAssetVerificationData(filename string) (checksum []byte, signature []byte, err error) {
+	cfg := vfl.updateConfig.ApplicationConfig
+	checksum, err = vfl.version.getAssetChecksum(vfl.ctx, cfg, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.isSignatureRequired() {
+		signature, err = getRequiredAssetSignature(vfl.ctx, cfg, vfl.version, filename)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return checksum, signature, nil
+}
+
+/*
+	checksum, signature - expected asset sha256 digest and signature, nil to skip verification
+*/
+func (vfl versionFilesLoader) loadUpdateFileFromSource(filename string, checksum, signature []byte) (_ string, err error) {
+	cfg := vfl.updateConfig.ApplicationConfig
+	vfl.updateConfig.Progress.assetStarted(filename, vfl.version.getAssetSize(filename))
+	var tFileName, cachedFilePath string
+	var reader io.ReadCloser
+	if cacheKey := vfl.version.getCacheKey(); vfl.updateConfig.CacheDir != "" && cacheKey != "" {
+		cachedFilePath, err = vfl.loadAssetToCache(cacheKey, filename)
+		if err != nil {
+			return "", err
+		}
+		reader, err = os.Open(cachedFilePath)
+	} else {
+		reader, _, err = vfl.openAsset(filename, 0)
+	}
 	if err != nil {
 		return "", err
 	}
-	return vfl.writeTempFileToDir(reader, filename)
+	tFileName, err = vfl.writeTempFileToDir(reader, filename, checksum)
+	if err == nil && signature != nil {
+		err = verifyFileSignature(cfg, tFileName, signature)
+		if err != nil {
+			err = fmt.Errorf("%w (%s)", err, filename)
+		}
+	}
+	if err != nil && cachedFilePath != "" && (errors.Is(err, ErrorAssetChecksumMismatch) || errors.Is(err, ErrorSignatureInvalid)) {
+		// cached asset is broken, it should be loaded again on next try
+		if rmErr := os.Remove(cachedFilePath); rmErr != nil {
+			err = fmt.Errorf("%v; remove broken cached asset error: %v", err, rmErr)
+		}
+	}
+	return tFileName, err
+}
+
+/*
+	open asset content with progress reporting
+
+	offset - asset content first byte, returned reader offset could differ if source doesn't support offsets
+*/
+func (vfl versionFilesLoader) openAsset(filename string, offset int64) (io.ReadCloser, int64, error) {
+	reader, err := vfl.version.getAssetContentByFilename(vfl.ctx, vfl.updateConfig.ApplicationConfig, filename, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	size := vfl.version.getAssetSize(filename)
+	readerSize, readerOffset := getReaderSizeAndOffset(reader)
+	if size == UnknownAssetSize {
+		size = readerSize
+	}
+	return &progressReadCloser{
+		ReadCloser: reader,
+		progress:   vfl.updateConfig.Progress,
+		filename:   filename,
+		loaded:     readerOffset,
+		size:       size,
+	}, readerOffset, nil
 }
 
-func (vfl versionFilesLoader) writeTempFileToDir(readerOrReaderCloser io.Reader, filename string) (_ string, err error) {
+/*
+	checksum - expected sha256 digest of written content, nil to skip verification
+*/
+func (vfl versionFilesLoader) writeTempFileToDir(readerOrReaderCloser io.Reader, filename string, checksum []byte) (_ string, err error) {
 	switch readerOrReaderCloser.(type) {
 	case io.ReadCloser:
 		defer func() {
@@ -773,6 +1256,23 @@ func (vfl versionFilesLoader) writeTempFileToDir(readerOrReaderCloser io.Reader,
 			err = tCloseErr
 		}
 	}()
-	_, err = io.Copy(tFile, readerOrReaderCloser)
-	return tFile.Name(), err
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tFile, hash), ctxReader{ctx: vfl.ctx, reader: readerOrReaderCloser})
+	if err != nil {
+		return tFile.Name(), err
+	}
+	return tFile.Name(), verifyChecksum(filename, checksum, hash.Sum(nil))
+}
+
+// reader stops reading on context cancel
+type ctxReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (cR ctxReader) Read(p []byte) (int, error) {
+	if err := cR.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cR.reader.Read(p)
 }
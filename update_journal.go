@@ -0,0 +1,336 @@
+package updaterini
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrorUpdateInterrupted    = errors.New("error. previous update is interrupted, recover it with RecoverInterruptedUpdate")
+	ErrorUpdateJournalInvalid = errors.New("error. update journal is invalid")
+)
+
+// journal of files replacing, it's kept in app dir during replacing and removed after update or rollback
+const updateJournalFilename = ".updaterini-journal.json"
+
+// prefix of update temp dirs, temp dir of interrupted update is removed after recovery
+const updateTempDirPrefix = ".updaterini-update-"
+
+type UpdateRecovery int
+
+const (
+	UpdateRecoveryNone          UpdateRecovery = iota // there is no interrupted update
+	UpdateRecoveryRolledForward                       // interrupted update is completed
+	UpdateRecoveryRolledBack                          // interrupted update is rolled back
+)
+
+func (ur UpdateRecovery) String() string {
+	switch ur {
+	case UpdateRecoveryNone:
+		return "no interrupted update"
+	case UpdateRecoveryRolledForward:
+		return "rolled forward"
+	case UpdateRecoveryRolledBack:
+		return "rolled back"
+	}
+	return "unknown recovery"
+}
+
+/*
+	file replacing step, step is saved before it's started. Step completion is detected by files existence,
+	because renames are atomic
+*/
+type updateJournalStep int
+
+const (
+	journalStepPlanned           updateJournalStep = iota
+	journalStepRenamingCurrent                     // current file is renamed to file with oldVersionReplacedFilesExtension
+	journalStepMovingReplacement                   // loaded file is moved to current file path
+)
+
+type updateJournalFile struct {
+	Path       string            `json:"path"`      // replacement file path
+	TempPath   string            `json:"temp_path"` // loaded file path
+	IsSymlink  bool              `json:"is_symlink,omitempty"`
+	Mode       fs.FileMode       `json:"mode"`
+	ModTime    time.Time         `json:"mod_time"`    // zero if it shouldn't be set
+	HasCurrent bool              `json:"has_current"` // current file exists and should be renamed
+	Owner      int               `json:"owner"`       // current file owner, -1 if it shouldn't be set
+	Group      int               `json:"group"`       // current file group, -1 if it shouldn't be set
+	Step       updateJournalStep `json:"step"`
+}
+
+type updateJournal struct {
+	dir     string              // app dir, journal is saved to
+	TempDir string              `json:"temp_dir"` // loaded files dir
+	Files   []updateJournalFile `json:"files"`
+}
+
+/*
+	loaded files are staged in app dir, so they are moved by rename on the same filesystem
+	and they aren't lost with system temp dir cleanup on reboot
+*/
+func newUpdateTempDir(dir string) (string, error) {
+	return os.MkdirTemp(dir, updateTempDirPrefix+"*")
+}
+
+func newUpdateJournal(dir, tempDir string) *updateJournal {
+	return &updateJournal{dir: dir, TempDir: tempDir}
+}
+
+// ok is false if there is no journal
+func loadUpdateJournal(dir string) (_ *updateJournal, ok bool, err error) {
+	content, err := os.ReadFile(filepath.Join(dir, updateJournalFilename))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	journal := newUpdateJournal(dir, "")
+	err = json.Unmarshal(content, journal)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrorUpdateJournalInvalid, err)
+	}
+	return journal, true, nil
+}
+
+/*
+	journal is written to temp file and renamed, both file and dir are synced.
+	So journal on disk is always complete
+*/
+func (uj *updateJournal) save() (err error) {
+	content, err := json.Marshal(uj)
+	if err != nil {
+		return err
+	}
+	journalPath := filepath.Join(uj.dir, updateJournalFilename)
+	tFile, err := os.OpenFile(journalPath+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = tFile.Write(content)
+	if err == nil {
+		err = tFile.Sync()
+	}
+	tCloseErr := tFile.Close()
+	if err == nil {
+		err = tCloseErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tFile.Name(), journalPath)
+	if err != nil {
+		return err
+	}
+	return syncDir(uj.dir)
+}
+
+/*
+	sync loaded files and their dir, so files moved on roll forward aren't truncated after power loss.
+	Call it before journal saving, journal steps are saved before loaded files are moved
+*/
+func (uj *updateJournal) syncLoadedFiles() error {
+	for _, file := range uj.Files {
+		if file.IsSymlink {
+			continue
+		}
+		err := syncFile(file.TempPath)
+		if err != nil {
+			return err
+		}
+	}
+	return syncDir(uj.TempDir)
+}
+
+func syncFile(filePath string) (err error) {
+	// windows flushes file buffers of writable file only
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmpErr := file.Close()
+		if err == nil {
+			err = tmpErr
+		}
+	}()
+	return file.Sync()
+}
+
+func (uj *updateJournal) remove() error {
+	err := os.Remove(filepath.Join(uj.dir, updateJournalFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return syncDir(uj.dir)
+}
+
+func (uj *updateJournal) saveStep(i int, step updateJournalStep) error {
+	if uj.Files[i].Step >= step {
+		return nil
+	}
+	uj.Files[i].Step = step
+	return uj.save()
+}
+
+/*
+	replace file from its saved step, it completes interrupted replacing too.
+	Every rename is saved to journal before it's done
+*/
+func (uj *updateJournal) replaceFile(i int) error {
+	file := uj.Files[i]
+	if file.HasCurrent && file.Step <= journalStepRenamingCurrent {
+		err := uj.saveStep(i, journalStepRenamingCurrent)
+		if err != nil {
+			return err
+		}
+		// current file is renamed already if it's absent
+		if _, err := os.Lstat(file.Path); err == nil {
+			err = os.Rename(file.Path, file.Path+oldVersionReplacedFilesExtension)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err := uj.saveStep(i, journalStepMovingReplacement)
+	if err != nil {
+		return err
+	}
+	// loaded file is moved already if it's absent
+	if _, err := os.Lstat(file.TempPath); err == nil {
+		err = os.Rename(file.TempPath, file.Path)
+		if err != nil {
+			return err
+		}
+	}
+	if file.IsSymlink {
+		// symlink attributes are link target attributes
+		return nil
+	}
+	err = os.Chmod(file.Path, file.Mode)
+	if err != nil {
+		return err
+	}
+	if file.HasCurrent && (file.Owner != -1 || file.Group != -1) {
+		err = os.Chown(file.Path, file.Owner, file.Group)
+		if err != nil {
+			return err
+		}
+	}
+	if !file.ModTime.IsZero() {
+		return os.Chtimes(file.Path, file.ModTime, file.ModTime)
+	}
+	return nil
+}
+
+// roll back files in reverse order by their saved steps and remove journal
+func (uj *updateJournal) rollback() error {
+	for i := len(uj.Files) - 1; i >= 0; i-- {
+		file := uj.Files[i]
+		if file.Step >= journalStepMovingReplacement {
+			// loaded file is moved if it's absent
+			if _, err := os.Lstat(file.TempPath); os.IsNotExist(err) {
+				err = os.Remove(file.Path)
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+		if file.HasCurrent && file.Step >= journalStepRenamingCurrent {
+			// current file is renamed if it's absent
+			if _, err := os.Lstat(file.Path); os.IsNotExist(err) {
+				err = os.Rename(file.Path+oldVersionReplacedFilesExtension, file.Path)
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+		}
+	}
+	return uj.remove()
+}
+
+// update could be completed if loaded files of not replaced files still exist
+func (uj *updateJournal) canRollForward() bool {
+	for _, file := range uj.Files {
+		if _, err := os.Lstat(file.TempPath); err == nil {
+			continue
+		}
+		if _, err := os.Lstat(file.Path); file.Step < journalStepMovingReplacement || err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+	RecoverInterruptedUpdate completes or rolls back update, which was interrupted during files replacing
+	(process was killed, power was lost). Call it on application start, DoUpdate returns ErrorUpdateInterrupted
+	until update is recovered. Update is completed if all its loaded files still exist, otherwise it's rolled back.
+	Temp dirs of updates interrupted during files loading are removed.
+	Files replaced by completed update have previous version files, use UnsafeDeletePreviousVersionFiles to delete them
+
+	dirPath - curAppDir of DoUpdate, cur exec file folder on empty string
+*/
+func RecoverInterruptedUpdate(dirPath string) (UpdateRecovery, error) {
+	if dirPath == "" {
+		exePath, err := os.Executable()
+		if err != nil {
+			return UpdateRecoveryNone, err
+		}
+		dirPath = filepath.Dir(exePath)
+	}
+	journal, ok, err := loadUpdateJournal(dirPath)
+	if err != nil {
+		return UpdateRecoveryNone, err
+	}
+	if !ok {
+		return UpdateRecoveryNone, removeUpdateTempDirs(dirPath)
+	}
+	recovery := UpdateRecoveryRolledBack
+	if journal.canRollForward() {
+		recovery = UpdateRecoveryRolledForward
+		for i := range journal.Files {
+			err = journal.replaceFile(i)
+			if err != nil {
+				return recovery, err
+			}
+		}
+		err = journal.remove()
+	} else {
+		err = journal.rollback()
+	}
+	if err != nil {
+		return recovery, err
+	}
+	// journal could be edited, only update temp dir is removed
+	if journal.TempDir != "" && strings.HasPrefix(filepath.Base(journal.TempDir), updateTempDirPrefix) {
+		err = os.RemoveAll(journal.TempDir)
+	}
+	return recovery, err
+}
+
+// remove temp dirs of updates, which were interrupted before files replacing
+func removeUpdateTempDirs(dirPath string) error {
+	dirEntries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range dirEntries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), updateTempDirPrefix) {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(dirPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package updaterini
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestRecoverInterruptedUpdateRollback(t *testing.T) {
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	appDir, err := ioutil.TempDir("", "triur-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(appDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	for _, filename := range []string{"app_a", "app_b"} {
+		err = os.WriteFile(filepath.Join(appDir, filename), []byte("old "+filename), 0644)
+		if err != nil {
+			t.Fatalf("write file err %s", err)
+		}
+	}
+	ver := testVersion(t, cfg, map[string][]byte{"app_a": []byte("new app_a"), "app_b": []byte("new app_b")})
+	getReplacementFileInfo := func(loadedFilename string) (ReplacementFile, error) {
+		return ReplacementFile{FileName: loadedFilename, Mode: ReplacementFileDefaultMode}, nil
+	}
+
+	// process is "killed" after the first file replacing, loaded files are removed
+	uc := UpdateConfig{ApplicationConfig: cfg, Progress: UpdateProgress{FileReplaced: func(filePath string) {
+		panic("interrupted")
+	}}}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("update isn't interrupted")
+			}
+		}()
+		_, _ = uc.DoUpdate(ver, appDir, getReplacementFileInfo, func() error {
+			return nil
+		})
+	}()
+	uc.Progress = UpdateProgress{}
+	_, err = uc.DoUpdate(ver, appDir, getReplacementFileInfo, func() error {
+		return nil
+	})
+	if !errors.Is(err, ErrorUpdateInterrupted) {
+		t.Errorf("update err: expected %v, fact %v", ErrorUpdateInterrupted, err)
+	}
+
+	recovery, err := RecoverInterruptedUpdate(appDir)
+	if err != nil || recovery != UpdateRecoveryRolledBack {
+		t.Fatalf("recovery err: %v, %s", err, recovery)
+	}
+	for _, filename := range []string{"app_a", "app_b"} {
+		content, err := os.ReadFile(filepath.Join(appDir, filename))
+		if err != nil || string(content) != "old "+filename {
+			t.Errorf("%s content err: %v, %q", filename, err, content)
+		}
+	}
+	dirEntries, err := os.ReadDir(appDir)
+	if err != nil || len(dirEntries) != 2 {
+		t.Errorf("app dir err: %v, %d files", err, len(dirEntries))
+	}
+	recovery, err = RecoverInterruptedUpdate(appDir)
+	if err != nil || recovery != UpdateRecoveryNone {
+		t.Errorf("second recovery err: %v, %s", err, recovery)
+	}
+}
+
+func TestRecoverInterruptedUpdateRollForward(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "triurf-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(appDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	updateTempDir, err := newUpdateTempDir(appDir)
+	if err != nil {
+		t.Fatalf("create update temp dir err %s", err)
+	}
+	writeFile := func(fPath, content string) {
+		err := os.WriteFile(fPath, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("write file err %s", err)
+		}
+	}
+	journal := newUpdateJournal(appDir, updateTempDir)
+	for _, file := range []struct {
+		filename   string
+		hasCurrent bool
+		step       updateJournalStep
+	}{
+		{filename: "app_replaced", hasCurrent: true, step: journalStepMovingReplacement},
+		{filename: "app_renamed", hasCurrent: true, step: journalStepRenamingCurrent},
+		{filename: "app_planned", hasCurrent: true, step: journalStepPlanned},
+		{filename: "app_created", step: journalStepPlanned},
+	} {
+		fPath, tempPath := filepath.Join(appDir, file.filename), filepath.Join(updateTempDir, file.filename)
+		writeFile(tempPath, "new "+file.filename)
+		if file.hasCurrent {
+			writeFile(fPath, "old "+file.filename)
+		}
+		// steps are done before interruption
+		if file.step >= journalStepRenamingCurrent {
+			err = os.Rename(fPath, fPath+oldVersionReplacedFilesExtension)
+		}
+		if err == nil && file.step >= journalStepMovingReplacement {
+			err = os.Rename(tempPath, fPath)
+		}
+		if err != nil {
+			t.Fatalf("%s: rename err %s", file.filename, err)
+		}
+		journal.Files = append(journal.Files, updateJournalFile{Path: fPath, TempPath: tempPath, Mode: ReplacementFileDefaultMode,
+			HasCurrent: file.hasCurrent, Owner: -1, Group: -1, Step: file.step})
+	}
+	err = journal.save()
+	if err != nil {
+		t.Fatalf("save journal err %s", err)
+	}
+
+	recovery, err := RecoverInterruptedUpdate(appDir)
+	if err != nil || recovery != UpdateRecoveryRolledForward {
+		t.Fatalf("recovery err: %v, %s", err, recovery)
+	}
+	for _, file := range journal.Files {
+		content, err := os.ReadFile(file.Path)
+		if err != nil || string(content) != "new "+filepath.Base(file.Path) {
+			t.Errorf("%s content err: %v, %q", file.Path, err, content)
+		}
+		if info, err := os.Stat(file.Path); err != nil || info.Mode().Perm() != ReplacementFileDefaultMode {
+			t.Errorf("%s mode err: %v", file.Path, err)
+		}
+		content, err = os.ReadFile(file.Path + oldVersionReplacedFilesExtension)
+		if file.HasCurrent && (err != nil || string(content) != "old "+filepath.Base(file.Path)) {
+			t.Errorf("%s previous version err: %v, %q", file.Path, err, content)
+		}
+	}
+	for _, fPath := range []string{updateTempDir, filepath.Join(appDir, updateJournalFilename)} {
+		if _, err := os.Stat(fPath); !os.IsNotExist(err) {
+			t.Errorf("%s isn't removed: %v", fPath, err)
+		}
+	}
+}
+
+func TestRecoverInterruptedUpdateRollForwardAfterKill(t *testing.T) {
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	appDir, err := ioutil.TempDir("", "triurfk-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(appDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	for _, filename := range []string{"app_a", "app_b"} {
+		err = os.WriteFile(filepath.Join(appDir, filename), []byte("old "+filename), 0644)
+		if err != nil {
+			t.Fatalf("write file err %s", err)
+		}
+	}
+	ver := testVersion(t, cfg, map[string][]byte{"app_a": []byte("new app_a"), "app_b": []byte("new app_b")})
+	getReplacementFileInfo := func(loadedFilename string) (ReplacementFile, error) {
+		return ReplacementFile{FileName: loadedFilename, Mode: ReplacementFileDefaultMode}, nil
+	}
+
+	// process is "killed" after the first file replacing. Killed process doesn't remove loaded files,
+	// so they are linked to backup dir and restored after panic
+	var updateTempDir, backupDir string
+	uc := UpdateConfig{ApplicationConfig: cfg, Progress: UpdateProgress{FileReplaced: func(filePath string) {
+		journal, ok, err := loadUpdateJournal(appDir)
+		if err != nil || !ok {
+			t.Fatalf("load journal err: %v, %t", err, ok)
+		}
+		updateTempDir = journal.TempDir
+		if filepath.Dir(updateTempDir) != appDir {
+			t.Errorf("loaded files aren't staged in app dir: %s", updateTempDir)
+		}
+		backupDir = filepath.Join(t.TempDir(), "backup")
+		err = os.Mkdir(backupDir, 0700)
+		if err != nil {
+			t.Fatalf("create backup dir err %s", err)
+		}
+		dirEntries, err := os.ReadDir(updateTempDir)
+		if err != nil {
+			t.Fatalf("read update temp dir err %s", err)
+		}
+		for _, entry := range dirEntries {
+			err = os.Link(filepath.Join(updateTempDir, entry.Name()), filepath.Join(backupDir, entry.Name()))
+			if err != nil {
+				t.Fatalf("link file err %s", err)
+			}
+		}
+		panic("interrupted")
+	}}}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("update isn't interrupted")
+			}
+		}()
+		_, _ = uc.DoUpdate(ver, appDir, getReplacementFileInfo, func() error {
+			return nil
+		})
+	}()
+	if updateTempDir == "" {
+		t.Fatalf("update temp dir is unknown")
+	}
+	err = os.Rename(backupDir, updateTempDir)
+	if err != nil {
+		t.Fatalf("restore update temp dir err %s", err)
+	}
+
+	recovery, err := RecoverInterruptedUpdate(appDir)
+	if err != nil || recovery != UpdateRecoveryRolledForward {
+		t.Fatalf("recovery err: %v, %s", err, recovery)
+	}
+	for _, filename := range []string{"app_a", "app_b"} {
+		content, err := os.ReadFile(filepath.Join(appDir, filename))
+		if err != nil || string(content) != "new "+filename {
+			t.Errorf("%s content err: %v, %q", filename, err, content)
+		}
+	}
+	if _, err := os.Stat(updateTempDir); !os.IsNotExist(err) {
+		t.Errorf("update temp dir isn't removed: %v", err)
+	}
+}
+
+func TestRecoverInterruptedUpdateRemovesTempDirs(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "triurtd-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(appDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	// update is interrupted during files loading, there is no journal
+	updateTempDir, err := newUpdateTempDir(appDir)
+	if err != nil {
+		t.Fatalf("create update temp dir err %s", err)
+	}
+	err = os.WriteFile(filepath.Join(updateTempDir, "app_file"), []byte("partial"), 0600)
+	if err != nil {
+		t.Fatalf("write file err %s", err)
+	}
+	recovery, err := RecoverInterruptedUpdate(appDir)
+	if err != nil || recovery != UpdateRecoveryNone {
+		t.Fatalf("recovery err: %v, %s", err, recovery)
+	}
+	if _, err := os.Stat(updateTempDir); !os.IsNotExist(err) {
+		t.Errorf("update temp dir isn't removed: %v", err)
+	}
+}
@@ -22,3 +22,18 @@ func (rF *updateFile) fillFileOwnerInfo(fInfo os.FileInfo) {
 		rF.curFileGroup = -1
 	}
 }
+
+// sync dir entries (created, renamed and removed files) to disk
+func syncDir(dirPath string) (err error) {
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmpErr := dir.Close()
+		if err == nil {
+			err = tmpErr
+		}
+	}()
+	return dir.Sync()
+}
@@ -0,0 +1,901 @@
+package updaterini
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+type testArchiveEntry struct {
+	name    string
+	content string
+}
+
+func testZipArchive(t *testing.T, entries []testArchiveEntry) []byte {
+	buf := &bytes.Buffer{}
+	zW := zip.NewWriter(buf)
+	for _, entry := range entries {
+		w, err := zW.Create(entry.name)
+		if err != nil {
+			t.Fatalf("create zip entry err: %s", err)
+		}
+		_, err = w.Write([]byte(entry.content))
+		if err != nil {
+			t.Fatalf("write zip entry err: %s", err)
+		}
+	}
+	err := zW.Close()
+	if err != nil {
+		t.Fatalf("close zip err: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func testVersion(t *testing.T, cfg ApplicationConfig, assets map[string][]byte) Version {
+	info := VersionInfo{Tag: "1.0.1"}
+	for filename := range assets {
+		info.Assets = append(info.Assets, VersionAsset{Filename: filename})
+	}
+	ver, err := NewVersion(cfg, info, func(_ context.Context, _ ApplicationConfig, filename string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(assets[filename])), nil
+	})
+	if err != nil {
+		t.Fatalf("create version err: %s", err)
+	}
+	return ver
+}
+
+func TestDoUpdateProgress(t *testing.T) {
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	assets := map[string][]byte{
+		"app_file": []byte("new app"),
+		"app_data.zip": testZipArchive(t, []testArchiveEntry{
+			{name: "data/first.txt", content: "first"},
+			{name: "data/second.txt", content: "second"},
+		}),
+	}
+	loaded := make(map[string]int64)
+	var extracted, replaced []string
+	uc := UpdateConfig{
+		ApplicationConfig: cfg,
+		Progress: UpdateProgress{
+			AssetStarted: func(filename string, size int64) {
+				loaded[filename] = 0
+			},
+			AssetLoading: func(filename string, loadedBytes, size int64) {
+				loaded[filename] = loadedBytes
+			},
+			ArchiveEntryExtracted: func(archiveFilename, entryName string) {
+				extracted = append(extracted, archiveFilename+":"+entryName)
+			},
+			FileReplaced: func(filePath string) {
+				replaced = append(replaced, filePath)
+			},
+		},
+	}
+	ver := testVersion(t, cfg, assets)
+
+	oldContent, newContent, firstContent, secondContent := "old app", "new app", "first", "second"
+	files := []file{
+		{relPath: "app_file", shouldStay: true, contentBeforeReplace: &oldContent, contentAfterReplace: &newContent},
+		{relPath: "data/first.txt", shouldStay: true, contentAfterReplace: &firstContent},
+		{relPath: "data/second.txt", shouldStay: true, contentAfterReplace: &secondContent},
+	}
+	testFilesFunction(files, func(appDir string) error {
+		uRes, err := uc.DoUpdate(ver, appDir, func(loadedFilename string) (ReplacementFile, error) {
+			return ReplacementFile{FileName: loadedFilename, Mode: ReplacementFileInfoUseDefaultOrExistedFilePerm}, nil
+		}, func() error {
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return uRes.DeletePreviousVersionFiles(DeleteModPureDelete)
+	}, t)
+
+	for filename, content := range assets {
+		if loaded[filename] != int64(len(content)) {
+			t.Errorf("asset loading progress err: %s loaded %d of %d", filename, loaded[filename], len(content))
+		}
+	}
+	if strings.Join(extracted, ",") != "app_data.zip:data/first.txt,app_data.zip:data/second.txt" {
+		t.Errorf("archive extraction progress err: %v", extracted)
+	}
+	if len(replaced) != 3 {
+		t.Errorf("files replacement progress err: %v", replaced)
+	}
+}
+
+func TestDoUpdateCancel(t *testing.T) {
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	uc := UpdateConfig{ApplicationConfig: cfg}
+	ctx, cancel := context.WithCancel(context.Background())
+	ver, err := NewVersion(cfg, VersionInfo{
+		Tag:    "1.0.1",
+		Assets: []VersionAsset{{Filename: "app_file"}},
+	}, func(_ context.Context, _ ApplicationConfig, filename string) (io.ReadCloser, error) {
+		cancel() // user cancels update during loading
+		return ioutil.NopCloser(strings.NewReader("1.0.1 content")), nil
+	})
+	if err != nil {
+		t.Fatalf("create version err: %s", err)
+	}
+	oldContent := "1.0.0 content"
+	files := []file{{relPath: "app_file", shouldStay: true, contentBeforeReplace: &oldContent, contentAfterReplace: &oldContent}}
+	testFilesFunction(files, func(appDir string) error {
+		_, err := uc.DoUpdateContext(ctx, ver, appDir, func(loadedFilename string) (ReplacementFile, error) {
+			return ReplacementFile{FileName: loadedFilename, Mode: ReplacementFileInfoUseDefaultOrExistedFilePerm}, nil
+		}, func() error {
+			t.Errorf("doBeforeUpdate shouldn't be called after cancel")
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("update err: expected %v, fact %v", context.Canceled, err)
+		}
+		return nil
+	}, t)
+}
+
+func TestParallelAssetsLoading(t *testing.T) {
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	errLoading := errors.New("asset loading error")
+	info := VersionInfo{Tag: "1.0.1"}
+	for i := 0; i < 8; i++ {
+		info.Assets = append(info.Assets, VersionAsset{Filename: fmt.Sprintf("app_%d", i)})
+	}
+	newVersion := func(failedAsset string) Version {
+		ver, err := NewVersion(cfg, info, func(ctx context.Context, _ ApplicationConfig, filename string) (io.ReadCloser, error) {
+			if filename == failedAsset {
+				return nil, errLoading
+			}
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return ioutil.NopCloser(strings.NewReader(filename + " content")), nil
+		})
+		if err != nil {
+			t.Fatalf("create version err: %s", err)
+		}
+		return ver
+	}
+	uc := UpdateConfig{ApplicationConfig: cfg, DownloadConcurrency: 3}
+
+	appDir, err := ioutil.TempDir("", "tpal-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(appDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	var callbacksOrder []string
+	getReplacementFileInfo := func(loadedFilename string) (ReplacementFile, error) {
+		callbacksOrder = append(callbacksOrder, loadedFilename)
+		return ReplacementFile{FileName: "renamed_" + loadedFilename, Mode: ReplacementFileDefaultMode}, nil
+	}
+	_, err = uc.DoUpdate(newVersion(""), appDir, getReplacementFileInfo, func() error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update err: %s", err)
+	}
+	for i, asset := range info.Assets {
+		if callbacksOrder[i] != asset.Filename {
+			t.Errorf("callbacks order err: expected %s, fact %s", asset.Filename, callbacksOrder[i])
+		}
+		fData, err := os.ReadFile(filepath.Join(appDir, "renamed_"+asset.Filename))
+		if err != nil {
+			t.Fatalf("file read err %s", err)
+		}
+		if string(fData) != asset.Filename+" content" {
+			t.Errorf("file content is incorect. filename: %s; fact content: %s", asset.Filename, fData)
+		}
+	}
+
+	_, err = uc.DoUpdate(newVersion("app_5"), appDir, getReplacementFileInfo, func() error {
+		t.Errorf("doBeforeUpdate shouldn't be called after loading error")
+		return nil
+	})
+	if !errors.Is(err, errLoading) {
+		t.Errorf("update err: expected %v, fact %v", errLoading, err)
+	}
+}
+
+func TestGetArchiveEntryPath(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"app_file":             true,
+		"data/app_file":        true,
+		"./data//app_file":     true,
+		"data\\app_file":       true,
+		"../app_file":          false,
+		"data/../../app_file":  false,
+		"data\\..\\..\\file":   false,
+		"/etc/app_file":        false,
+		"\\\\server\\app_file": false,
+		"C:/app_file":          false,
+		"":                     false,
+		"./":                   false,
+	} {
+		entryPath, err := getArchiveEntryPath(name)
+		if (err == nil) != valid || (err != nil && !errors.Is(err, ErrorArchiveEntryPathInvalid)) {
+			t.Errorf("%q: expected valid %v, fact path %q, err %v", name, valid, entryPath, err)
+		}
+	}
+}
+
+func TestArchiveExtractionProtection(t *testing.T) {
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	tempDir, err := ioutil.TempDir("", "taep-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	appDir, outsideDir := filepath.Join(tempDir, "app"), filepath.Join(tempDir, "outside")
+	for _, dir := range []string{appDir, outsideDir} {
+		err = os.Mkdir(dir, 0755)
+		if err != nil {
+			t.Fatalf("create dir err %s", err)
+		}
+	}
+	// symlinks creation could be not permitted on windows
+	symlinkErr := os.Symlink(outsideDir, filepath.Join(appDir, "linked"))
+	manyEntries := make([]testArchiveEntry, 10)
+	for i := range manyEntries {
+		manyEntries[i] = testArchiveEntry{name: fmt.Sprintf("file_%d", i), content: "content"}
+	}
+
+	for _, test := range []struct {
+		name        string
+		entries     []testArchiveEntry
+		limits      ArchiveLimits
+		expectedErr error
+		limit       ArchiveLimit
+	}{
+		{name: "parent dir", entries: []testArchiveEntry{{name: "../app_evil", content: "evil"}}, expectedErr: ErrorArchiveEntryPathInvalid},
+		{name: "absolute path", entries: []testArchiveEntry{{name: "/app_evil", content: "evil"}}, expectedErr: ErrorArchiveEntryPathInvalid},
+		{name: "symlink dir", entries: []testArchiveEntry{{name: "linked/app_evil", content: "evil"}}, expectedErr: ErrorArchiveEntryPathInvalid},
+		{name: "entries count", entries: manyEntries, limits: ArchiveLimits{MaxEntries: 5}, expectedErr: ErrorArchiveLimitExceeded, limit: ArchiveLimitEntries},
+		{name: "total size", entries: manyEntries, limits: ArchiveLimits{MaxTotalSize: 50}, expectedErr: ErrorArchiveLimitExceeded, limit: ArchiveLimitTotalSize},
+		{name: "compression ratio", entries: []testArchiveEntry{{name: "zeros", content: strings.Repeat("0", 4<<20)}},
+			expectedErr: ErrorArchiveLimitExceeded, limit: ArchiveLimitCompressionRatio},
+		{name: "disabled limits", entries: []testArchiveEntry{{name: "zeros", content: strings.Repeat("0", 4<<20)}},
+			limits: ArchiveLimits{MaxTotalSize: -1, MaxEntries: -1, MaxCompressionRatio: -1}},
+	} {
+		if test.name == "symlink dir" && symlinkErr != nil {
+			t.Logf("symlink test is skipped: %s", symlinkErr)
+			continue
+		}
+		uc := UpdateConfig{ApplicationConfig: cfg, ArchiveLimits: test.limits}
+		ver := testVersion(t, cfg, map[string][]byte{"app_data.zip": testZipArchive(t, test.entries)})
+		uRes, err := uc.DoUpdate(ver, appDir, func(loadedFilename string) (ReplacementFile, error) {
+			return ReplacementFile{FileName: loadedFilename, Mode: ReplacementFileDefaultMode}, nil
+		}, func() error {
+			return nil
+		})
+		if !errors.Is(err, test.expectedErr) || (test.expectedErr == nil) != (err == nil) {
+			t.Errorf("%s: update err: expected %v, fact %v", test.name, test.expectedErr, err)
+			continue
+		}
+		var limitErr *ArchiveLimitError
+		if errors.As(err, &limitErr) && limitErr.Limit != test.limit {
+			t.Errorf("%s: limit err: expected %s, fact %s", test.name, test.limit, limitErr.Limit)
+		}
+		if err == nil {
+			err = uRes.DeletePreviousVersionFiles(DeleteModPureDelete)
+			if err != nil {
+				t.Errorf("%s: delete previous version err: %s", test.name, err)
+			}
+		}
+	}
+	for _, dir := range []string{tempDir, outsideDir} {
+		if _, err := os.Stat(filepath.Join(dir, "app_evil")); !os.IsNotExist(err) {
+			t.Errorf("file outside of app dir is created in %s: %v", dir, err)
+		}
+	}
+}
+
+func testTarArchive(t *testing.T, headers []tar.Header, contents []string) []byte {
+	buf := &bytes.Buffer{}
+	tW := tar.NewWriter(buf)
+	for i := range headers {
+		headers[i].Size = int64(len(contents[i]))
+		err := tW.WriteHeader(&headers[i])
+		if err != nil {
+			t.Fatalf("write tar header err: %s", err)
+		}
+		_, err = tW.Write([]byte(contents[i]))
+		if err != nil {
+			t.Fatalf("write tar entry err: %s", err)
+		}
+	}
+	err := tW.Close()
+	if err != nil {
+		t.Fatalf("close tar err: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func testTarGzArchive(t *testing.T, headers []tar.Header, contents []string) []byte {
+	return testCompress(t, testTarArchive(t, headers, contents), func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	})
+}
+
+func testCompress(t *testing.T, content []byte, newWriter func(w io.Writer) (io.WriteCloser, error)) []byte {
+	buf := &bytes.Buffer{}
+	w, err := newWriter(buf)
+	if err == nil {
+		_, err = w.Write(content)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		t.Fatalf("compress err: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestAssetFormats(t *testing.T) {
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	tempDir, err := ioutil.TempDir("", "taf-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	RegisterAssetFormat(AssetFormat{
+		Name:       "test base64",
+		Extensions: []string{".b64"},
+		Decompress: func(content io.Reader) (io.ReadCloser, error) {
+			return ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, content)), nil
+		},
+	})
+	newXzWriter := func(w io.Writer) (io.WriteCloser, error) {
+		return xz.NewWriter(w)
+	}
+	newZstWriter := func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	}
+	testTar := func(name, content string) []byte {
+		return testTarArchive(t, []tar.Header{{Name: name, Mode: 0644, Typeflag: tar.TypeReg}}, []string{content})
+	}
+	// tar.bz2 with app_bz2 file, bzip2 writer is absent in std lib
+	tarBz2, err := base64.StdEncoding.DecodeString("QlpoOTFBWSZTWditWxYAAG/7gMqAAQBAAXWAACDzJF4QCAggAFQyiBoB5RoPSekEkptQyAABofWSKEINXQhEOr6xpPSgQwMRqteDIdhCRIjm4uXJFlKDQX4TnRGpixd6vUbkkD8XckU4UJDYrVsW")
+	if err != nil {
+		t.Fatalf("decode tar.bz2 err: %s", err)
+	}
+
+	for _, test := range []struct {
+		name            string
+		assets          map[string][]byte
+		detectByContent bool
+		expectedFiles   map[string]string
+	}{
+		{name: "by extension", assets: map[string][]byte{
+			"app_tar.tar":        testTar("app_tar", "tar file"),
+			"app_xz.tar.xz":      testCompress(t, testTar("app_xz", "tar.xz file"), newXzWriter),
+			"app_zst.TAR.ZST":    testCompress(t, testTar("app_zst", "tar.zst file"), newZstWriter),
+			"app_bz2.tbz2":       tarBz2,
+			"app_single_gz.gz":   testCompress(t, []byte("gz file"), func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }),
+			"app_single_zst.zst": testCompress(t, []byte("zst file"), newZstWriter),
+			"app_custom.b64":     []byte(base64.StdEncoding.EncodeToString([]byte("custom file"))),
+		}, expectedFiles: map[string]string{
+			"app_tar": "tar file", "app_xz": "tar.xz file", "app_zst": "tar.zst file", "app_bz2": "tar.bz2 file",
+			"app_single_gz": "gz file", "app_single_zst": "zst file", "app_custom": "custom file",
+		}},
+		{name: "by content", detectByContent: true, assets: map[string][]byte{
+			"app_detected_tar": testTar("app_tar_entry", "tar entry"),
+			"app_detected_xz":  testCompress(t, []byte("xz file"), newXzWriter),
+			"app_raw":          []byte("raw file"),
+		}, expectedFiles: map[string]string{
+			"app_tar_entry": "tar entry", "app_detected_xz": "xz file", "app_raw": "raw file",
+		}},
+		{name: "content is not detected", assets: map[string][]byte{
+			"app_not_detected": testCompress(t, []byte("xz file"), newXzWriter),
+		}, expectedFiles: map[string]string{
+			"app_not_detected": string(testCompress(t, []byte("xz file"), newXzWriter)),
+		}},
+	} {
+		appDir, err := ioutil.TempDir(tempDir, "app-*")
+		if err != nil {
+			t.Fatalf("create app dir err %s", err)
+		}
+		uc := UpdateConfig{ApplicationConfig: cfg, DetectAssetsFormatsByContent: test.detectByContent}
+		_, err = uc.DoUpdate(testVersion(t, cfg, test.assets), appDir, func(loadedFilename string) (ReplacementFile, error) {
+			return ReplacementFile{FileName: loadedFilename, Mode: ReplacementFileDefaultMode}, nil
+		}, func() error {
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: update err: %s", test.name, err)
+			continue
+		}
+		for filename, expectedContent := range test.expectedFiles {
+			content, err := os.ReadFile(filepath.Join(appDir, filename))
+			if err != nil || string(content) != expectedContent {
+				t.Errorf("%s: %s content err: %v, %q", test.name, filename, err, content)
+			}
+		}
+		dirEntries, err := os.ReadDir(appDir)
+		if err != nil || len(dirEntries) != len(test.expectedFiles) {
+			t.Errorf("%s: app dir err: %v, %d files", test.name, err, len(dirEntries))
+		}
+	}
+}
+
+func TestPreserveArchiveAttributes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions and symlinks are required")
+	}
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	modTime := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	zipBuf := &bytes.Buffer{}
+	zW := zip.NewWriter(zipBuf)
+	zHeader := &zip.FileHeader{Name: "bin/zip_tool", Modified: modTime}
+	zHeader.SetMode(0750)
+	w, err := zW.CreateHeader(zHeader)
+	if err == nil {
+		_, err = w.Write([]byte("zip tool"))
+	}
+	if err == nil {
+		err = zW.Close()
+	}
+	if err != nil {
+		t.Fatalf("create zip err: %s", err)
+	}
+	assets := map[string][]byte{
+		"app_data.tar.gz": testTarGzArchive(t, []tar.Header{
+			{Name: "bin/tool", Mode: 0755, ModTime: modTime, Typeflag: tar.TypeReg},
+			{Name: "bin/tool_hardlink", Mode: 0755, ModTime: modTime, Typeflag: tar.TypeLink, Linkname: "bin/tool"},
+			{Name: "tool_symlink", Mode: 0777, ModTime: modTime, Typeflag: tar.TypeSymlink, Linkname: "bin/tool"},
+		}, []string{"tool", "", ""}),
+		"app_data.zip": zipBuf.Bytes(),
+	}
+
+	for _, preserve := range []bool{false, true} {
+		appDir, err := ioutil.TempDir("", "tpaa-*")
+		if err != nil {
+			t.Fatalf("create temp dir err %s", err)
+		}
+		uc := UpdateConfig{ApplicationConfig: cfg, PreserveArchiveAttributes: preserve}
+		_, err = uc.DoUpdate(testVersion(t, cfg, assets), appDir, func(loadedFilename string) (ReplacementFile, error) {
+			return ReplacementFile{FileName: loadedFilename, Mode: ReplacementFileInfoUseDefaultOrExistedFilePerm}, nil
+		}, func() error {
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("preserve %v: update err: %s", preserve, err)
+		}
+		expectedModes := map[string]os.FileMode{"bin/tool": 0644, "bin/zip_tool": 0644}
+		if preserve {
+			expectedModes = map[string]os.FileMode{"bin/tool": 0755, "bin/tool_hardlink": 0755, "bin/zip_tool": 0750}
+		}
+		for relPath, mode := range expectedModes {
+			info, err := os.Stat(filepath.Join(appDir, relPath))
+			if err != nil {
+				t.Errorf("preserve %v: %s stat err: %s", preserve, relPath, err)
+				continue
+			}
+			if info.Mode().Perm() != mode || (preserve && !info.ModTime().Equal(modTime)) {
+				t.Errorf("preserve %v: %s attributes err: mode %s, mod time %s", preserve, relPath, info.Mode(), info.ModTime())
+			}
+		}
+		target, err := os.Readlink(filepath.Join(appDir, "tool_symlink"))
+		if preserve != (err == nil) || (preserve && target != "bin/tool") {
+			t.Errorf("preserve %v: symlink err: %s, target %s", preserve, err, target)
+		}
+		if content, err := os.ReadFile(filepath.Join(appDir, "bin/tool_hardlink")); preserve && (err != nil || string(content) != "tool") {
+			t.Errorf("preserve %v: hardlink err: %v, content %s", preserve, err, content)
+		}
+		err = os.RemoveAll(appDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}
+
+	appDir, err := ioutil.TempDir("", "tpaa-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(appDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	uc := UpdateConfig{ApplicationConfig: cfg, PreserveArchiveAttributes: true}
+	for _, linkname := range []string{"../../outside", "/etc/passwd", "../bin/../../outside"} {
+		ver := testVersion(t, cfg, map[string][]byte{"app_data.tar.gz": testTarGzArchive(t, []tar.Header{
+			{Name: "bin/evil_symlink", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: linkname},
+		}, []string{""})})
+		_, err = uc.DoUpdate(ver, appDir, func(loadedFilename string) (ReplacementFile, error) {
+			return ReplacementFile{FileName: loadedFilename, Mode: ReplacementFileDefaultMode}, nil
+		}, func() error {
+			t.Errorf("doBeforeUpdate shouldn't be called after extraction error")
+			return nil
+		})
+		if !errors.Is(err, ErrorArchiveEntryPathInvalid) {
+			t.Errorf("symlink %s err: expected %v, fact %v", linkname, ErrorArchiveEntryPathInvalid, err)
+		}
+	}
+}
+
+func TestReplacementAssetsDestinations(t *testing.T) {
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	tempDir, err := ioutil.TempDir("", "trad-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	appDir, sharedDir := filepath.Join(tempDir, "app"), filepath.Join(tempDir, "shared")
+	for _, dir := range []string{appDir, sharedDir} {
+		err = os.Mkdir(dir, 0755)
+		if err != nil {
+			t.Fatalf("create dir err %s", err)
+		}
+	}
+	ver := testVersion(t, cfg, map[string][]byte{
+		"app_data.zip": testZipArchive(t, []testArchiveEntry{
+			{name: "config/app.yaml", content: "config"},
+			{name: "plugins/app.yaml", content: "plugin"},
+			{name: "bin/app_tool", content: "tool"},
+		}),
+		"app_readme": []byte("readme"),
+	})
+
+	uc := UpdateConfig{ApplicationConfig: cfg, AllowedDestinationRoots: []string{sharedDir}}
+	assets := make(map[string]ReplacementAsset)
+	uRes, err := uc.DoUpdateWithAssets(ver, appDir, func(asset ReplacementAsset) (ReplacementFile, error) {
+		assets[asset.ArchivePath] = asset
+		replacement := ReplacementFile{FileName: asset.Filename, Mode: ReplacementFileDefaultMode}
+		switch asset.ArchivePath {
+		case "config/app.yaml":
+			replacement.DestPath = filepath.Join("etc", "app.yaml")
+		case "plugins/app.yaml":
+			replacement.DestPath = filepath.Join(sharedDir, "plugins", "app.yaml")
+		}
+		return replacement, nil
+	}, func() error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("update err: %s", err)
+	}
+	for archivePath, expected := range map[string]ReplacementAsset{
+		"":                 {Filename: "app_readme", Size: UnknownAssetSize},
+		"config/app.yaml":  {Filename: "app.yaml", Size: 6},
+		"plugins/app.yaml": {Filename: "app.yaml", Size: 6},
+		"bin/app_tool":     {Filename: "app_tool", Size: 4},
+	} {
+		asset := assets[archivePath]
+		if asset.Filename != expected.Filename || asset.Size != expected.Size ||
+			(archivePath != "" && (asset.Asset.Filename != "app_data.zip" || !asset.Mode.IsRegular())) {
+			t.Errorf("%s asset err: %+v", archivePath, asset)
+		}
+	}
+	for fPath, expectedContent := range map[string]string{
+		filepath.Join(appDir, "etc", "app.yaml"):        "config",
+		filepath.Join(sharedDir, "plugins", "app.yaml"): "plugin",
+		filepath.Join(appDir, "bin", "app_tool"):        "tool",
+		filepath.Join(appDir, "app_readme"):             "readme",
+	} {
+		content, err := os.ReadFile(fPath)
+		if err != nil || string(content) != expectedContent {
+			t.Errorf("%s content err: %v, %q", fPath, err, content)
+		}
+	}
+	err = uRes.RollbackChanges()
+	if err != nil {
+		t.Errorf("rollback err: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(sharedDir, "plugins", "app.yaml")); !os.IsNotExist(err) {
+		t.Errorf("absolute destination file is not rolled back: %v", err)
+	}
+
+	for _, destPath := range []string{"../app_evil", filepath.Join(tempDir, "app_evil"), sharedDir} {
+		_, err = uc.DoUpdateWithAssets(ver, appDir, func(asset ReplacementAsset) (ReplacementFile, error) {
+			return ReplacementFile{FileName: asset.Filename, DestPath: destPath, Mode: ReplacementFileDefaultMode}, nil
+		}, func() error {
+			return nil
+		})
+		if !errors.Is(err, ErrorReplacementDestinationInvalid) {
+			t.Errorf("%s: update err: expected %v, fact %v", destPath, ErrorReplacementDestinationInvalid, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "app_evil")); !os.IsNotExist(err) {
+		t.Errorf("file outside of allowed dirs is created: %v", err)
+	}
+}
+
+func TestRemappedSymlinkTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are required")
+	}
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	tempDir, err := ioutil.TempDir("", "trst-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	appDir, sharedDir := filepath.Join(tempDir, "app"), filepath.Join(tempDir, "shared")
+	for _, dir := range []string{appDir, sharedDir} {
+		err = os.Mkdir(dir, 0755)
+		if err != nil {
+			t.Fatalf("create dir err %s", err)
+		}
+	}
+	// symlink target is inside archive root, but not inside app dir or shared dir after remapping
+	ver := testVersion(t, cfg, map[string][]byte{"app_data.tar.gz": testTarGzArchive(t, []tar.Header{
+		{Name: "a/b/link", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: "../../x"},
+	}, []string{""})})
+	uc := UpdateConfig{ApplicationConfig: cfg, PreserveArchiveAttributes: true, AllowedDestinationRoots: []string{sharedDir}}
+	for _, test := range []struct {
+		destPath    string
+		expectedErr error
+	}{
+		{destPath: "link", expectedErr: ErrorArchiveEntryPathInvalid},
+		{destPath: filepath.Join(sharedDir, "link"), expectedErr: ErrorArchiveEntryPathInvalid},
+		{destPath: filepath.Join(sharedDir, "c", "d", "link")},
+		{destPath: filepath.Join("c", "d", "link")},
+	} {
+		uRes, err := uc.DoUpdateWithAssets(ver, appDir, func(asset ReplacementAsset) (ReplacementFile, error) {
+			if asset.LinkTarget != "../../x" {
+				t.Errorf("%s: link target err: %s", test.destPath, asset.LinkTarget)
+			}
+			return ReplacementFile{FileName: asset.Filename, DestPath: test.destPath, Mode: ReplacementFileDefaultMode}, nil
+		}, func() error {
+			return nil
+		})
+		if !errors.Is(err, test.expectedErr) || (test.expectedErr == nil) != (err == nil) {
+			t.Errorf("%s: update err: expected %v, fact %v", test.destPath, test.expectedErr, err)
+			continue
+		}
+		if err == nil {
+			err = uRes.RollbackChanges()
+			if err != nil {
+				t.Errorf("%s: rollback err: %s", test.destPath, err)
+			}
+		}
+	}
+}
+
+func TestSymlinkTargetThroughExistingSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are required")
+	}
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	tempDir, err := ioutil.TempDir("", "tstes-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(tempDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	appDir, outsideDir := filepath.Join(tempDir, "app"), filepath.Join(tempDir, "outside", "dir")
+	for _, dir := range []string{appDir, outsideDir} {
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatalf("create dir err %s", err)
+		}
+	}
+	// symlink is left by previous update
+	err = os.Symlink(outsideDir, filepath.Join(appDir, "prev"))
+	if err != nil {
+		t.Fatalf("create symlink err %s", err)
+	}
+	uc := UpdateConfig{ApplicationConfig: cfg, PreserveArchiveAttributes: true}
+	for _, test := range []struct {
+		linkname    string
+		expectedErr error
+	}{
+		{linkname: "prev/x", expectedErr: ErrorArchiveEntryPathInvalid},
+		{linkname: "prev/../x", expectedErr: ErrorArchiveEntryPathInvalid},
+		{linkname: "x"},
+	} {
+		ver := testVersion(t, cfg, map[string][]byte{"app_data.tar.gz": testTarGzArchive(t, []tar.Header{
+			{Name: "link", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: test.linkname},
+		}, []string{""})})
+		uRes, err := uc.DoUpdate(ver, appDir, func(loadedFilename string) (ReplacementFile, error) {
+			return ReplacementFile{FileName: loadedFilename, Mode: ReplacementFileDefaultMode}, nil
+		}, func() error {
+			return nil
+		})
+		if !errors.Is(err, test.expectedErr) || (test.expectedErr == nil) != (err == nil) {
+			t.Errorf("%s: update err: expected %v, fact %v", test.linkname, test.expectedErr, err)
+			continue
+		}
+		if err == nil {
+			err = uRes.RollbackChanges()
+			if err != nil {
+				t.Errorf("%s: rollback err: %s", test.linkname, err)
+			}
+		}
+	}
+}
+
+func TestChainedSymlinkTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are required")
+	}
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	uc := UpdateConfig{ApplicationConfig: cfg, PreserveArchiveAttributes: true}
+	for _, test := range []struct {
+		name        string
+		headers     []tar.Header
+		contents    []string
+		destPaths   map[string]string // replacement paths by archive path
+		expectedErr error
+	}{
+		{
+			name: "archive chain",
+			headers: []tar.Header{
+				{Name: "d/file", Mode: 0644, Typeflag: tar.TypeReg, Size: 4},
+				{Name: "d/l2", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: ".."},
+				{Name: "d/l1", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: "l2/../../secret"},
+			},
+			contents:    []string{"file", "", ""},
+			expectedErr: ErrorArchiveEntryPathInvalid,
+		},
+		{
+			// archive symlinks aren't chained, but remapped l2 is on l1 target path
+			name: "remapped chain",
+			headers: []tar.Header{
+				{Name: "a/l2", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: "."},
+				{Name: "l1", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: "l3/../secret"},
+			},
+			contents:    []string{"", ""},
+			destPaths:   map[string]string{"a/l2": "l3"},
+			expectedErr: ErrorArchiveEntryPathInvalid,
+		},
+		{
+			name: "symlink to symlink",
+			headers: []tar.Header{
+				{Name: "lib.so.1.2", Mode: 0644, Typeflag: tar.TypeReg, Size: 3},
+				{Name: "lib.so.1", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: "lib.so.1.2"},
+				{Name: "lib.so", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: "lib.so.1"},
+			},
+			contents: []string{"lib", "", ""},
+		},
+	} {
+		tempDir, err := ioutil.TempDir("", "tcst-*")
+		if err != nil {
+			t.Fatalf("create temp dir err %s", err)
+		}
+		appDir := filepath.Join(tempDir, "app")
+		err = os.Mkdir(appDir, 0755)
+		if err != nil {
+			t.Fatalf("create dir err %s", err)
+		}
+		ver := testVersion(t, cfg, map[string][]byte{"app_data.tar.gz": testTarGzArchive(t, test.headers, test.contents)})
+		_, err = uc.DoUpdateWithAssets(ver, appDir, func(asset ReplacementAsset) (ReplacementFile, error) {
+			return ReplacementFile{FileName: asset.Filename, DestPath: test.destPaths[asset.ArchivePath], Mode: ReplacementFileDefaultMode}, nil
+		}, func() error {
+			return nil
+		})
+		if !errors.Is(err, test.expectedErr) || (test.expectedErr == nil) != (err == nil) {
+			t.Errorf("%s: update err: expected %v, fact %v", test.name, test.expectedErr, err)
+		}
+		if test.expectedErr == nil {
+			content, err := os.ReadFile(filepath.Join(appDir, "lib.so"))
+			if err != nil || string(content) != "lib" {
+				t.Errorf("%s: symlink content err: %v, %q", test.name, err, content)
+			}
+		}
+		err = os.RemoveAll(tempDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}
+}
+
+func TestChainedArchiveSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are required")
+	}
+	cfg, err := NewApplicationConfig("1.0.0", []Channel{NewReleaseChannel(true)}, []*regexp.Regexp{regexp.MustCompile("^app_")})
+	if err != nil {
+		t.Fatalf("creating app config err: %s", err)
+	}
+	appDir, err := ioutil.TempDir("", "tcas-*")
+	if err != nil {
+		t.Fatalf("create temp dir err %s", err)
+	}
+	defer func() {
+		err := os.RemoveAll(appDir)
+		if err != nil {
+			t.Errorf("delete temp dir err %s", err)
+		}
+	}()
+	uc := UpdateConfig{ApplicationConfig: cfg, PreserveArchiveAttributes: true}
+	chain := []tar.Header{
+		{Name: "d/l2", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "d/l1", Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: "l2/../../secret"},
+	}
+	// chained symlink could be before its link
+	for _, headers := range [][]tar.Header{chain, {chain[1], chain[0]}} {
+		ver := testVersion(t, cfg, map[string][]byte{"app_data.tar.gz": testTarGzArchive(t, headers, []string{"", ""})})
+		_, err = uc.DoUpdate(ver, appDir, func(loadedFilename string) (ReplacementFile, error) {
+			return ReplacementFile{FileName: loadedFilename, Mode: ReplacementFileDefaultMode}, nil
+		}, func() error {
+			t.Errorf("doBeforeUpdate shouldn't be called after extraction error")
+			return nil
+		})
+		if !errors.Is(err, ErrorArchiveEntryPathInvalid) {
+			t.Errorf("%s first: update err: expected %v, fact %v", headers[0].Name, ErrorArchiveEntryPathInvalid, err)
+		}
+	}
+}
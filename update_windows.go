@@ -6,7 +6,6 @@ package updaterini
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 	"syscall"
 )
@@ -20,7 +19,7 @@ func (uR *UpdateResult) deletePrevVersionFiles() (err error) {
 		if !file.curFileRenamed {
 			continue
 		}
-		fPath := filepath.Join(uR.updateDir, file.replacement.FileName+oldVersionReplacedFilesExtension)
+		fPath := file.replacement.getFilePath(uR.updateDir) + oldVersionReplacedFilesExtension
 		err = os.Remove(fPath)
 		if err != nil {
 			errFiles = append(errFiles, fPath)
@@ -56,3 +55,8 @@ func (rF *updateFile) fillFileOwnerInfo(_ os.FileInfo) {
 	rF.curFileOwner = -1
 	rF.curFileGroup = -1
 }
+
+// dirs can't be synced on Windows, renames are flushed with file system journal
+func syncDir(_ string) error {
+	return nil
+}
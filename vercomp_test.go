@@ -33,12 +33,7 @@ func testLatestVersionSearch(curVersion versionTest, channels []Channel, testVer
 	for _, testVer := range testVers {
 		ver, err := newVersionGit(cfg, gitData{
 			Version: testVer.version,
-			Assets: []struct {
-				Size     int
-				Id       int
-				Filename string `json:"name"`
-				Url      string `json:"browser_download_url"`
-			}{
+			Assets: []gitAsset{
 				{Size: 1, Id: 1, Filename: "v1.0.1_linux_amd64", Url: ""},
 				{Size: 1, Id: 2, Filename: "v1.0.1_windows_amd64", Url: ""},
 			},
@@ -1,6 +1,8 @@
 package updaterini
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -29,14 +31,110 @@ func isVersionFilenameCorrect(filename string, filenameRegex []*regexp.Regexp) b
 	return false
 }
 
+// Version of any source, use NewVersion to create version for custom UpdateSource
 type Version interface {
 	getVersion() semver.Version
 	getChannel() Channel
 	getAssetsFilenames() []string
-	getAssetContentByFilename(cfg ApplicationConfig, filename string) (io.ReadCloser, error)
+	getAssetSize(filename string) int64                                                                                         // UnknownAssetSize if source doesn't provide it
+	getCacheKey() string                                                                                                        // unique version key for assets cache, empty string if version couldn't be cached
+	getAssetContentByFilename(ctx context.Context, cfg ApplicationConfig, filename string, offset int64) (io.ReadCloser, error) // offset could be ignored by source
+	getAssetChecksum(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error)                               // sha256 digest, nil if asset has no checksum
+	getAssetSignature(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error)                              // ed25519 signature, nil if asset is unsigned
 	VersionName() string
 	VersionTag() string
 	VersionDescription() string
+	VersionReleaseDate() time.Time      // zero time if source doesn't provide it
+	VersionIsMandatory() bool           // version is marked as mandatory (critical) update
+	VersionMinUpdateFrom() string       // min current version that could be updated directly to this version, empty if any
+	VersionMetadata() map[string]string // arbitrary source metadata, nil if source doesn't provide it
+	VersionAssets() []AssetInfo         // version files
+}
+
+// AssetInfo describes version file
+type AssetInfo struct {
+	Filename    string
+	Size        int64  // UnknownAssetSize if source doesn't provide it
+	SHA256      string // checksum in hex, empty if source doesn't provide it before loading
+	ContentType string // empty if source doesn't provide it
+}
+
+const errorVersionMinUpdateFromInvalid = "min update from version is invalid"
+
+// version details shared by all sources
+type versionDetails struct {
+	releaseDate   time.Time
+	mandatory     bool
+	minUpdateFrom string
+	metadata      map[string]string
+	assetsInfo    []AssetInfo
+}
+
+func newVersionDetails(version string, releaseDate time.Time, mandatory bool, minUpdateFrom string, metadata map[string]string) (versionDetails, error) {
+	if minUpdateFrom != "" {
+		if _, err := ParseVersion(minUpdateFrom); err != nil {
+			return versionDetails{}, fmt.Errorf("%s: %s (%s)", version, errorVersionMinUpdateFromInvalid, err)
+		}
+	}
+	return versionDetails{
+		releaseDate:   releaseDate,
+		mandatory:     mandatory,
+		minUpdateFrom: minUpdateFrom,
+		metadata:      metadata,
+	}, nil
+}
+
+func (vd *versionDetails) VersionReleaseDate() time.Time {
+	return vd.releaseDate
+}
+
+func (vd *versionDetails) VersionIsMandatory() bool {
+	return vd.mandatory
+}
+
+func (vd *versionDetails) VersionMinUpdateFrom() string {
+	return vd.minUpdateFrom
+}
+
+func (vd *versionDetails) VersionMetadata() map[string]string {
+	return vd.metadata
+}
+
+func (vd *versionDetails) VersionAssets() []AssetInfo {
+	result := make([]AssetInfo, len(vd.assetsInfo))
+	copy(result, vd.assetsInfo)
+	return result
+}
+
+func (vd *versionDetails) addAssetInfo(info AssetInfo) {
+	if info.Size <= 0 {
+		info.Size = UnknownAssetSize
+	}
+	vd.assetsInfo = append(vd.assetsInfo, info)
+}
+
+func (vd *versionDetails) getAssetInfo(filename string) (AssetInfo, bool) {
+	for _, info := range vd.assetsInfo {
+		if info.Filename == filename {
+			return info, true
+		}
+	}
+	return AssetInfo{}, false
+}
+
+/*
+	check if current version could be updated directly to ver. Current version is lower than version min update from
+	version, if it returns false. Update through intermediate version is required then
+*/
+func (ac *ApplicationConfig) CanUpdateDirectly(ver Version) bool {
+	if ver.VersionMinUpdateFrom() == "" {
+		return true
+	}
+	minVersion, err := ParseVersion(ver.VersionMinUpdateFrom())
+	if err != nil {
+		return false
+	}
+	return ac.currentVersion.version.Compare(minVersion) >= 0
 }
 
 func getLatestVersion(cfg ApplicationConfig, versions []Version) Version {
@@ -62,6 +160,15 @@ func getLatestVersion(cfg ApplicationConfig, versions []Version) Version {
 	return versions[maxVersionIndex]
 }
 
+// version is newer than current version and could be chosen by getLatestVersion
+func isUpdateCandidate(cfg ApplicationConfig, version semver.Version, channel Channel) bool {
+	if !channel.useForUpdate {
+		return false
+	}
+	compareResult := prepareVersionForComparison(version).Compare(prepareVersionForComparison(cfg.currentVersion.version))
+	return compareResult == 1 || (compareResult == 0 && channel.weight > cfg.currentVersion.channel.weight)
+}
+
 func prepareVersionForComparison(version semver.Version) semver.Version {
 	if len(version.Pre) > 0 {
 		version.Pre = version.Pre[1:]
@@ -113,16 +220,21 @@ type gitData struct {
 	ReleaseDate time.Time `json:"published_at"`
 	Description string    `json:"body"`
 	Version     string    `json:"tag_name"`
-	Assets      []struct {
-		Size     int
-		Id       int
-		Filename string `json:"name"`
-		Url      string `json:"browser_download_url"`
-	}
+	Assets      []gitAsset
+}
+
+type gitAsset struct {
+	Size        int
+	Id          int
+	Filename    string `json:"name"`
+	Url         string `json:"browser_download_url"`
+	ContentType string `json:"content_type"`
 }
 
 type versionGit struct {
+	versionDetails
 	data    gitData
+	assets  releaseAssets
 	channel Channel
 	source  UpdateSourceGitRepo
 	version semver.Version
@@ -132,23 +244,22 @@ func newVersionGit(cfg ApplicationConfig, data gitData, src UpdateSourceGitRepo)
 	vG := versionGit{
 		data: data,
 	}
-
-	// remove unused assets, validate version
-	assetsCounter := 0
-	filenames := make(map[string]struct{})
-	for _, asset := range vG.data.Assets {
-		if isVersionFilenameCorrect(asset.Filename, cfg.ValidateFilesNamesRegexes) {
-			vG.data.Assets[assetsCounter] = asset
-			if _, ok := filenames[asset.Filename]; ok {
-				return versionGit{}, fmt.Errorf("%s: %s (%s)", data.Version, errorVersionRepeatingFilenames, asset.Filename)
-			}
-			filenames[asset.Filename] = struct{}{}
-			assetsCounter++
-		}
+	filenames := make([]string, len(data.Assets))
+	for i, asset := range data.Assets {
+		filenames[i] = asset.Filename
 	}
-	vG.data.Assets = vG.data.Assets[:assetsCounter]
-	if assetsCounter == 0 {
-		return versionGit{}, fmt.Errorf("%s: %s", data.Version, errorVersionInvalid)
+	assets, err := newReleaseAssets(cfg, data.Version, filenames, src.ChecksumsFilename)
+	if err != nil {
+		return versionGit{}, err
+	}
+	vG.assets = assets
+	vG.versionDetails, err = newVersionDetails(data.Version, data.ReleaseDate, false, "", nil)
+	if err != nil {
+		return versionGit{}, err
+	}
+	for _, filename := range assets.getFilenames() {
+		asset, _ := vG.findAsset(filename)
+		vG.addAssetInfo(AssetInfo{Filename: filename, Size: int64(asset.Size), ContentType: asset.ContentType})
 	}
 
 	version, channel, err := parseVersion(cfg, data.Version)
@@ -182,41 +293,272 @@ func (vG *versionGit) getChannel() Channel {
 }
 
 func (vG *versionGit) getAssetsFilenames() []string {
-	result := make([]string, len(vG.data.Assets))
-	for i, asset := range vG.data.Assets {
-		result[i] = asset.Filename
+	return vG.assets.getFilenames()
+}
+
+func (vG *versionGit) getCacheKey() string {
+	if vG.source.APIBaseURL != "" {
+		return fmt.Sprintf("%s/%s/%s/%s/%s", vG.source.SourceLabel(), vG.source.getAPIBaseUrl(), vG.source.UserName, vG.source.RepoName, vG.data.Version)
 	}
-	return result
+	return fmt.Sprintf("%s/%s/%s/%s", vG.source.SourceLabel(), vG.source.UserName, vG.source.RepoName, vG.data.Version)
 }
 
-func (vG *versionGit) getAssetContentByFilename(cfg ApplicationConfig, filename string) (io.ReadCloser, error) {
+// find any release asset, including checksums and signatures files
+func (vG *versionGit) findAsset(filename string) (gitAsset, bool) {
 	for _, asset := range vG.data.Assets {
-		if asset.Filename != filename {
-			continue
+		if asset.Filename == filename {
+			return asset, true
 		}
-		return vG.source.loadSourceFile(cfg, asset.Id)
+	}
+	return gitAsset{}, false
+}
+
+func (vG *versionGit) getAssetSize(filename string) int64 {
+	if asset, ok := vG.findAsset(filename); ok && vG.assets.hasFile(filename) {
+		return int64(asset.Size)
+	}
+	return UnknownAssetSize
+}
+
+func (vG *versionGit) getAssetContentByFilename(ctx context.Context, cfg ApplicationConfig, filename string, offset int64) (io.ReadCloser, error) {
+	if asset, ok := vG.findAsset(filename); ok && vG.assets.hasFile(filename) {
+		return vG.source.loadSourceFile(ctx, cfg, asset.Id, offset)
 	}
 	return nil, errors.New(errorAssetNotFoundByFilename)
 }
 
+func (vG *versionGit) loadAssetContent(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error) {
+	asset, ok := vG.findAsset(filename)
+	if !ok {
+		return nil, errors.New(errorAssetNotFoundByFilename)
+	}
+	return vG.source.loadSourceFileContent(ctx, cfg, asset.Id)
+}
+
+func (vG *versionGit) getAssetChecksum(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error) {
+	return vG.assets.getAssetChecksum(ctx, cfg, filename, vG.loadAssetContent)
+}
+
+func (vG *versionGit) getAssetSignature(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error) {
+	return vG.assets.getAssetSignature(ctx, cfg, filename, vG.loadAssetContent)
+}
+
+// loads small release asset content (checksums file, signature)
+type releaseAssetLoader func(ctx context.Context, cfg ApplicationConfig, filename string) ([]byte, error)
+
+/*
+	files of release based sources (GitHub, GitLab etc.). Checksums file and signatures are separate release files,
+	they are loaded on first use
+*/
+type releaseAssets struct {
+	version            string
+	filenames          []string          // valid version files
+	checksumsFilename  string            // empty if source doesn't use checksums file
+	signatureFilenames map[string]string // version file (or checksums file) to signature file, filled if signature is required
+	checksums          map[string][]byte // loaded from checksums file on first use
+	signatures         map[string][]byte // loaded from signature files on first use
+}
+
+/*
+	validate release files. Invalid files, signatures and checksums file are not version files
+
+	checksumsFilename - release file with sha256 checksums of other files, release without it is invalid. Ignored on empty
+*/
+func newReleaseAssets(cfg ApplicationConfig, version string, filenames []string, checksumsFilename string) (releaseAssets, error) {
+	ra := releaseAssets{
+		version: version,
+	}
+
+	allFilenames := make(map[string]struct{}, len(filenames))
+	for _, filename := range filenames {
+		allFilenames[filename] = struct{}{}
+	}
+	findSignatureFile := func(filename string) error {
+		if !cfg.isSignatureRequired() {
+			return nil
+		}
+		if _, ok := allFilenames[filename+signatureFileExtension]; !ok {
+			return fmt.Errorf("%s: %w (%s)", version, ErrorSignatureNotFound, filename)
+		}
+		if ra.signatureFilenames == nil {
+			ra.signatureFilenames = make(map[string]string)
+		}
+		ra.signatureFilenames[filename] = filename + signatureFileExtension
+		return nil
+	}
+
+	uniqFilenames := make(map[string]struct{})
+	for _, filename := range filenames {
+		if checksumsFilename != "" && filename == checksumsFilename {
+			ra.checksumsFilename = filename
+			continue
+		}
+		if cfg.isSignatureRequired() && strings.HasSuffix(filename, signatureFileExtension) {
+			continue
+		}
+		if isVersionFilenameCorrect(filename, cfg.ValidateFilesNamesRegexes) {
+			if _, ok := uniqFilenames[filename]; ok {
+				return releaseAssets{}, fmt.Errorf("%s: %s (%s)", version, errorVersionRepeatingFilenames, filename)
+			}
+			uniqFilenames[filename] = struct{}{}
+			if err := findSignatureFile(filename); err != nil {
+				return releaseAssets{}, err
+			}
+			ra.filenames = append(ra.filenames, filename)
+		}
+	}
+	if len(ra.filenames) == 0 {
+		return releaseAssets{}, fmt.Errorf("%s: %s", version, errorVersionInvalid)
+	}
+	if checksumsFilename != "" {
+		if ra.checksumsFilename == "" {
+			return releaseAssets{}, fmt.Errorf("%s: %s (%s)", version, errorChecksumsFileNotFound, checksumsFilename)
+		}
+		if err := findSignatureFile(ra.checksumsFilename); err != nil {
+			return releaseAssets{}, err
+		}
+	}
+	return ra, nil
+}
+
+func (ra *releaseAssets) getFilenames() []string {
+	result := make([]string, len(ra.filenames))
+	copy(result, ra.filenames)
+	return result
+}
+
+func (ra *releaseAssets) hasFile(filename string) bool {
+	for _, raFilename := range ra.filenames {
+		if raFilename == filename {
+			return true
+		}
+	}
+	return false
+}
+
+// set checksum provided by source, used if release has no checksums file
+func (ra *releaseAssets) setAssetChecksum(filename string, checksum []byte) {
+	if ra.checksums == nil {
+		ra.checksums = make(map[string][]byte)
+	}
+	ra.checksums[filename] = checksum
+}
+
+// load checksums file once and verify its signature, if ApplicationConfig has trusted keys
+func (ra *releaseAssets) loadChecksums(ctx context.Context, cfg ApplicationConfig, load releaseAssetLoader) error {
+	if ra.checksumsFilename == "" || ra.checksums != nil {
+		return nil
+	}
+	content, err := load(ctx, cfg, ra.checksumsFilename)
+	if err != nil {
+		return err
+	}
+	if cfg.isSignatureRequired() {
+		signature, err := ra.getAssetSignature(ctx, cfg, ra.checksumsFilename, load)
+		if err != nil {
+			return err
+		}
+		err = cfg.VerifySignature(content, signature)
+		if err != nil {
+			return fmt.Errorf("%s: %w (%s)", ra.version, err, ra.checksumsFilename)
+		}
+	}
+	checksums, err := parseChecksumsFile(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	ra.checksums = checksums
+	return nil
+}
+
+/*
+	verify checksums file signature on versions listing, so release with tampered checksums file is reported
+	by source. Checksums are loaded on update otherwise
+*/
+func (ra *releaseAssets) verifyChecksumsSignature(ctx context.Context, cfg ApplicationConfig, load releaseAssetLoader) error {
+	if !cfg.isSignatureRequired() {
+		return nil
+	}
+	return ra.loadChecksums(ctx, cfg, load)
+}
+
+func (ra *releaseAssets) getAssetChecksum(ctx context.Context, cfg ApplicationConfig, filename string, load releaseAssetLoader) ([]byte, error) {
+	if ra.checksumsFilename == "" {
+		return ra.checksums[filename], nil
+	}
+	err := ra.loadChecksums(ctx, cfg, load)
+	if err != nil {
+		return nil, err
+	}
+	checksum, ok := ra.checksums[filename]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s (%s)", ra.version, errorChecksumNotFoundForFile, filename)
+	}
+	return checksum, nil
+}
+
+func (ra *releaseAssets) getAssetSignature(ctx context.Context, cfg ApplicationConfig, filename string, load releaseAssetLoader) ([]byte, error) {
+	sigFilename, ok := ra.signatureFilenames[filename]
+	if !ok {
+		return nil, nil
+	}
+	if signature, ok := ra.signatures[filename]; ok {
+		return signature, nil
+	}
+	content, err := load(ctx, cfg, sigFilename)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := parseSignature(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w (%s)", ra.version, err, sigFilename)
+	}
+	if ra.signatures == nil {
+		ra.signatures = make(map[string][]byte)
+	}
+	ra.signatures[filename] = signature
+	return signature, nil
+}
+
 type ServData struct {
-	VersionFolderUrl string `json:"folder_url"`  // version folder url
-	Name             string `json:"name"`        // release summary
-	Description      string `json:"description"` // release description
-	Version          string `json:"version"`     // version tag
-	Assets           []struct {
-		Filename string `json:"filename"` // version files filenames, filenames adds to VersionFolderUrl
-	} `json:"assets"` // version files
+	VersionFolderUrl string            `json:"folder_url"`                // version folder url
+	Name             string            `json:"name"`                      // release summary
+	Description      string            `json:"description"`               // release description
+	Version          string            `json:"version"`                   // version tag
+	ReleaseDate      time.Time         `json:"release_date"`              // optional release publish date
+	Mandatory        bool              `json:"mandatory,omitempty"`       // optional mandatory (critical) update flag
+	MinUpdateFrom    string            `json:"min_update_from,omitempty"` // optional min current version that could be updated directly to this version
+	Metadata         map[string]string `json:"metadata,omitempty"`        // optional arbitrary metadata
+	Assets           []ServAsset       `json:"assets"`                    // version files
+}
+
+type ServAsset struct {
+	Filename    string `json:"filename"`               // version file filename, filename adds to VersionFolderUrl
+	URL         string `json:"url,omitempty"`          // optional absolute version file url, used instead of VersionFolderUrl + Filename
+	Size        int64  `json:"size,omitempty"`         // optional version file size
+	ContentType string `json:"content_type,omitempty"` // optional version file content type
+	SHA256      string `json:"sha256,omitempty"`       // optional version file sha256 checksum in hex
+	Signature   string `json:"signature,omitempty"`    // optional version file ed25519 signature in base64, required if ApplicationConfig has trusted keys
+}
+
+// source of ServData versions files
+type servFilesSource interface {
+	SourceLabel() string
+	getSourceKey() string                                                                                                       // unique source key for assets cache, empty string if source files shouldn't be cached
+	loadSourceFile(ctx context.Context, cfg ApplicationConfig, folderUrl, filename string, offset int64) (io.ReadCloser, error) // offset could be ignored by source
 }
 
 type versionServ struct {
-	data    ServData
-	channel Channel
-	source  UpdateSourceServer
-	version semver.Version
+	versionDetails
+	data       ServData
+	channel    Channel
+	source     servFilesSource
+	version    semver.Version
+	checksums  map[string][]byte
+	signatures map[string][]byte
 }
 
-func newVersionServ(cfg ApplicationConfig, data ServData, src UpdateSourceServer) (versionServ, error) {
+func newVersionServ(cfg ApplicationConfig, data ServData, src servFilesSource) (versionServ, error) {
 	vS := versionServ{
 		data: data,
 	}
@@ -231,6 +573,26 @@ func newVersionServ(cfg ApplicationConfig, data ServData, src UpdateSourceServer
 				return versionServ{}, fmt.Errorf("%s: %s (%s)", data.Version, errorVersionRepeatingFilenames, asset.Filename)
 			}
 			filenames[asset.Filename] = struct{}{}
+			if asset.SHA256 != "" {
+				checksum, err := parseSHA256Checksum(asset.SHA256)
+				if err != nil {
+					return versionServ{}, fmt.Errorf("%s: %s", data.Version, err)
+				}
+				if vS.checksums == nil {
+					vS.checksums = make(map[string][]byte)
+				}
+				vS.checksums[asset.Filename] = checksum
+			}
+			if cfg.isSignatureRequired() {
+				signature, err := parseAssetSignature(data.Version, asset.Filename, asset.Signature)
+				if err != nil {
+					return versionServ{}, err
+				}
+				if vS.signatures == nil {
+					vS.signatures = make(map[string][]byte)
+				}
+				vS.signatures[asset.Filename] = signature
+			}
 			assetsCounter++
 		}
 	}
@@ -238,6 +600,14 @@ func newVersionServ(cfg ApplicationConfig, data ServData, src UpdateSourceServer
 	if assetsCounter == 0 {
 		return versionServ{}, fmt.Errorf("%s: %s", data.Version, errorVersionInvalid)
 	}
+	details, err := newVersionDetails(data.Version, data.ReleaseDate, data.Mandatory, data.MinUpdateFrom, data.Metadata)
+	if err != nil {
+		return versionServ{}, err
+	}
+	vS.versionDetails = details
+	for _, asset := range vS.data.Assets {
+		vS.addAssetInfo(AssetInfo{Filename: asset.Filename, Size: asset.Size, SHA256: asset.SHA256, ContentType: asset.ContentType})
+	}
 
 	version, channel, err := parseVersion(cfg, data.Version)
 	if err != nil {
@@ -277,12 +647,213 @@ func (vS *versionServ) getAssetsFilenames() []string {
 	return result
 }
 
-func (vS *versionServ) getAssetContentByFilename(cfg ApplicationConfig, filename string) (io.ReadCloser, error) {
+func (vS *versionServ) getCacheKey() string {
+	sourceKey := vS.source.getSourceKey()
+	if sourceKey == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%s", vS.source.SourceLabel(), sourceKey, vS.data.Version)
+}
+
+func (vS *versionServ) getAssetSize(filename string) int64 {
+	if info, ok := vS.getAssetInfo(filename); ok {
+		return info.Size
+	}
+	return UnknownAssetSize
+}
+
+func (vS *versionServ) getAssetContentByFilename(ctx context.Context, cfg ApplicationConfig, filename string, offset int64) (io.ReadCloser, error) {
 	for _, asset := range vS.data.Assets {
 		if asset.Filename != filename {
 			continue
 		}
-		return vS.source.loadSourceFile(cfg, vS.data.VersionFolderUrl, asset.Filename)
+		if asset.URL != "" {
+			return vS.source.loadSourceFile(ctx, cfg, "", asset.URL, offset)
+		}
+		return vS.source.loadSourceFile(ctx, cfg, vS.data.VersionFolderUrl, asset.Filename, offset)
+	}
+	return nil, errors.New(errorAssetNotFoundByFilename)
+}
+
+func (vS *versionServ) getAssetChecksum(_ context.Context, _ ApplicationConfig, filename string) ([]byte, error) {
+	return vS.checksums[filename], nil
+}
+
+func (vS *versionServ) getAssetSignature(_ context.Context, _ ApplicationConfig, filename string) ([]byte, error) {
+	return vS.signatures[filename], nil
+}
+
+// VersionAsset describes version file of custom UpdateSource
+type VersionAsset struct {
+	Filename    string // version file filename
+	Size        int64  // optional version file size
+	ContentType string // optional version file content type
+	SHA256      string // optional version file sha256 checksum in hex
+	Signature   string // optional version file ed25519 signature in base64, required if ApplicationConfig has trusted keys
+}
+
+// VersionInfo describes version of custom UpdateSource, use it with NewVersion
+type VersionInfo struct {
+	Name        string         // release summary
+	Description string         // release description
+	Tag         string         // version tag, parsed with ApplicationConfig channels
+	Assets      []VersionAsset // version files
+	SourceKey   string         // optional unique source key (url, path etc.), on empty version assets are not cached in UpdateConfig.CacheDir
+
+	ReleaseDate   time.Time         // optional release publish date
+	Mandatory     bool              // optional mandatory (critical) update flag
+	MinUpdateFrom string            // optional min current version that could be updated directly to this version
+	Metadata      map[string]string // optional arbitrary metadata
+}
+
+// AssetOpener opens version file content by filename. Library closes returned reader, ctx cancels loading
+type AssetOpener func(ctx context.Context, cfg ApplicationConfig, filename string) (io.ReadCloser, error)
+
+// asset opener of library sources, offset - asset content first byte, source could ignore it and return full content
+type assetRangeOpener func(ctx context.Context, cfg ApplicationConfig, filename string, offset int64) (io.ReadCloser, error)
+
+type versionCustom struct {
+	versionDetails
+	info       VersionInfo
+	channel    Channel
+	version    semver.Version
+	openAsset  assetRangeOpener
+	checksums  map[string][]byte
+	signatures map[string][]byte
+}
+
+/*
+	Create version for custom UpdateSource. Version is validated the same way as versions of library sources
+
+	openAsset - used to load version files during update
+*/
+func NewVersion(cfg ApplicationConfig, info VersionInfo, openAsset AssetOpener) (Version, error) {
+	if openAsset == nil {
+		return nil, errors.New("asset opener is nil")
+	}
+	return newVersionCustom(cfg, info, func(ctx context.Context, cfg ApplicationConfig, filename string, _ int64) (io.ReadCloser, error) {
+		return openAsset(ctx, cfg, filename)
+	})
+}
+
+/*
+	create custom version with offset aware opener, it's used by library sources supporting partial content
+*/
+func newVersionCustom(cfg ApplicationConfig, info VersionInfo, openAsset assetRangeOpener) (Version, error) {
+	vC := versionCustom{
+		info:      info,
+		openAsset: openAsset,
+	}
+
+	// remove unused assets, validate version
+	vC.info.Assets = make([]VersionAsset, 0, len(info.Assets))
+	filenames := make(map[string]struct{})
+	for _, asset := range info.Assets {
+		if isVersionFilenameCorrect(asset.Filename, cfg.ValidateFilesNamesRegexes) {
+			if _, ok := filenames[asset.Filename]; ok {
+				return nil, fmt.Errorf("%s: %s (%s)", info.Tag, errorVersionRepeatingFilenames, asset.Filename)
+			}
+			filenames[asset.Filename] = struct{}{}
+			if asset.SHA256 != "" {
+				checksum, err := parseSHA256Checksum(asset.SHA256)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s", info.Tag, err)
+				}
+				if vC.checksums == nil {
+					vC.checksums = make(map[string][]byte)
+				}
+				vC.checksums[asset.Filename] = checksum
+			}
+			if cfg.isSignatureRequired() {
+				signature, err := parseAssetSignature(info.Tag, asset.Filename, asset.Signature)
+				if err != nil {
+					return nil, err
+				}
+				if vC.signatures == nil {
+					vC.signatures = make(map[string][]byte)
+				}
+				vC.signatures[asset.Filename] = signature
+			}
+			vC.info.Assets = append(vC.info.Assets, asset)
+		}
+	}
+	if len(vC.info.Assets) == 0 {
+		return nil, fmt.Errorf("%s: %s", info.Tag, errorVersionInvalid)
+	}
+	details, err := newVersionDetails(info.Tag, info.ReleaseDate, info.Mandatory, info.MinUpdateFrom, info.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	vC.versionDetails = details
+	for _, asset := range vC.info.Assets {
+		vC.addAssetInfo(AssetInfo{Filename: asset.Filename, Size: asset.Size, SHA256: asset.SHA256, ContentType: asset.ContentType})
+	}
+
+	version, channel, err := parseVersion(cfg, info.Tag)
+	if err != nil {
+		return nil, err
+	}
+	vC.version = version
+	vC.channel = channel
+	return &vC, nil
+}
+
+func (vC *versionCustom) VersionName() string {
+	return vC.info.Name
+}
+
+func (vC *versionCustom) VersionTag() string {
+	return vC.info.Tag
+}
+
+func (vC *versionCustom) VersionDescription() string {
+	return vC.info.Description
+}
+
+func (vC *versionCustom) getVersion() semver.Version {
+	return vC.version
+}
+
+func (vC *versionCustom) getChannel() Channel {
+	return vC.channel
+}
+
+func (vC *versionCustom) getAssetsFilenames() []string {
+	result := make([]string, len(vC.info.Assets))
+	for i, asset := range vC.info.Assets {
+		result[i] = asset.Filename
+	}
+	return result
+}
+
+func (vC *versionCustom) getCacheKey() string {
+	if vC.info.SourceKey == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", vC.info.SourceKey, vC.info.Tag)
+}
+
+func (vC *versionCustom) getAssetSize(filename string) int64 {
+	if info, ok := vC.getAssetInfo(filename); ok {
+		return info.Size
+	}
+	return UnknownAssetSize
+}
+
+func (vC *versionCustom) getAssetContentByFilename(ctx context.Context, cfg ApplicationConfig, filename string, offset int64) (io.ReadCloser, error) {
+	for _, asset := range vC.info.Assets {
+		if asset.Filename != filename {
+			continue
+		}
+		return vC.openAsset(ctx, cfg, filename, offset)
 	}
 	return nil, errors.New(errorAssetNotFoundByFilename)
 }
+
+func (vC *versionCustom) getAssetChecksum(_ context.Context, _ ApplicationConfig, filename string) ([]byte, error) {
+	return vC.checksums[filename], nil
+}
+
+func (vC *versionCustom) getAssetSignature(_ context.Context, _ ApplicationConfig, filename string) ([]byte, error) {
+	return vC.signatures[filename], nil
+}